@@ -0,0 +1,280 @@
+// Package alert evaluates alert rules on the latest router poll and sends
+// notifications, for sites without Alertmanager.
+package alert
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// Rule fires if its condition holds on every poll for at least For.
+type Rule struct {
+	Name      string        `yaml:"name" json:"name"`
+	Condition string        `yaml:"condition" json:"condition"`
+	Threshold float64       `yaml:"threshold" json:"threshold"`
+	For       time.Duration `yaml:"for" json:"for"`
+	Severity  string        `yaml:"severity" json:"severity"`
+}
+
+// Config is the --alert-rules file.
+type Config struct {
+	Rules     []Rule           `yaml:"rules"`
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+}
+
+// State of an alert.
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert is an active instance of a rule, e.g. low SNR on one channel.
+type Alert struct {
+	Rule     string            `json:"rule"`
+	Severity string            `json:"severity,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	State    State             `json:"state"`
+	Value    float64           `json:"value"`
+	Summary  string            `json:"summary"`
+	ActiveAt time.Time         `json:"active_at"`
+	Silenced bool              `json:"silenced"`
+
+	// notified is true once a firing notification was sent, so the
+	// resolution is only sent for alerts users have heard of.
+	notified bool
+}
+
+// Silence suppresses notifications for a rule, or all rules if Rule is "*".
+type Silence struct {
+	Id      int       `json:"id"`
+	Rule    string    `json:"rule"`
+	Until   time.Time `json:"until"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// Engine keeps the alert state between polls.
+type Engine struct {
+	Rules     []Rule
+	Notifiers []Notifier
+	// Health rates channels for channel_critical. DefaultHealthProfile is used if nil.
+	Health *collector.HealthProfile
+
+	mutex       sync.Mutex
+	alerts      map[string]*Alert
+	silences    []Silence
+	lastSilence int
+	lastDevices map[string]int // per rule, for lan_devices_changed
+}
+
+// notifyTimeout limits the time all notifiers may take per poll.
+const notifyTimeout = 30 * time.Second
+
+// LoadConfig reads and validates an --alert-rules file.
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "parsing alert rules")
+	}
+	names := map[string]bool{}
+	for _, rule := range config.Rules {
+		if rule.Name == "" || names[rule.Name] {
+			return nil, errors.New("alert rules: missing or duplicate name '" + rule.Name + "'")
+		}
+		names[rule.Name] = true
+		if _, ok := conditions[rule.Condition]; !ok {
+			return nil, errors.New("alert rule " + rule.Name + ": unknown condition '" + rule.Condition +
+				"', expected one of " + strings.Join(conditionNames(), ", "))
+		}
+	}
+	return &config, nil
+}
+
+// NewEngine creates an engine for config.
+func NewEngine(config *Config) (*Engine, error) {
+	e := &Engine{Rules: config.Rules, alerts: map[string]*Alert{}, lastDevices: map[string]int{}}
+	for _, rule := range config.Rules {
+		// a change is only visible for the poll it happened in
+		if rule.Condition == "lan_devices_changed" && rule.For > 0 {
+			return nil, errors.New("alert rule " + rule.Name + ": lan_devices_changed compares two polls and can't use 'for'")
+		}
+		// without a threshold every poll would match, even without a change
+		if rule.Condition == "lan_devices_changed" && rule.Threshold <= 0 {
+			return nil, errors.New("alert rule " + rule.Name + ": lan_devices_changed needs a threshold above 0")
+		}
+	}
+	for _, c := range config.Notifiers {
+		notifier, err := c.build()
+		if err != nil {
+			return nil, err
+		}
+		e.Notifiers = append(e.Notifiers, notifier)
+	}
+	return e, nil
+}
+
+// Evaluate checks all rules against the sections fetched since the poll
+// started and sends notifications for alerts which started firing or resolved.
+func (e *Engine) Evaluate(status *collector.Status, since, now time.Time) {
+	e.mutex.Lock()
+	var notifications []Alert
+	for i := range e.Rules {
+		rule := &e.Rules[i]
+		instances, ok := conditions[rule.Condition](e, rule, status, since)
+		if !ok {
+			// no fresh data, keep the alerts as they are
+			continue
+		}
+		active := map[string]bool{}
+		for _, instance := range instances {
+			key := alertKey(rule.Name, instance.labels)
+			active[key] = true
+			alert, ok := e.alerts[key]
+			if !ok {
+				alert = &Alert{Rule: rule.Name, Severity: rule.Severity, Labels: instance.labels,
+					State: StatePending, ActiveAt: now}
+				e.alerts[key] = alert
+			}
+			alert.Value, alert.Summary = instance.value, instance.summary
+			if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+				alert.State = StateFiring
+			}
+		}
+		for key, alert := range e.alerts {
+			if alert.Rule != rule.Name || active[key] {
+				continue
+			}
+			delete(e.alerts, key)
+			if alert.notified && !e.silenced(alert.Rule, now) {
+				resolved := *alert
+				resolved.State = StateResolved
+				notifications = append(notifications, resolved)
+			}
+		}
+	}
+	for _, alert := range e.alerts {
+		alert.Silenced = e.silenced(alert.Rule, now)
+		if alert.State == StateFiring && !alert.notified && !alert.Silenced {
+			alert.notified = true
+			notifications = append(notifications, *alert)
+		}
+	}
+	e.expireSilences(now)
+	e.mutex.Unlock()
+
+	if len(notifications) == 0 {
+		return
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return alertKey(notifications[i].Rule, notifications[i].Labels) < alertKey(notifications[j].Rule, notifications[j].Labels)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	for _, notifier := range e.Notifiers {
+		if err := notifier.Notify(ctx, notifications); err != nil {
+			log.Warn("Sending alert notification: ", err)
+		}
+	}
+}
+
+// Alerts returns the pending and firing alerts, sorted by rule and labels.
+func (e *Engine) Alerts() []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alertKey(alerts[i].Rule, alerts[i].Labels) < alertKey(alerts[j].Rule, alerts[j].Labels)
+	})
+	return alerts
+}
+
+// Silence suppresses notifications for rule until the given time and
+// returns the silence's id.
+func (e *Engine) Silence(rule string, until time.Time, comment string) int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lastSilence++
+	e.silences = append(e.silences, Silence{Id: e.lastSilence, Rule: rule, Until: until, Comment: comment})
+	e.updateSilenced(time.Now())
+	return e.lastSilence
+}
+
+// Expire removes a silence. It returns false if there is no such silence.
+func (e *Engine) Expire(id int) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for i, s := range e.silences {
+		if s.Id == id {
+			e.silences = append(e.silences[:i], e.silences[i+1:]...)
+			e.updateSilenced(time.Now())
+			return true
+		}
+	}
+	return false
+}
+
+// Silences returns the active silences.
+func (e *Engine) Silences() []Silence {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.expireSilences(time.Now())
+	return append([]Silence(nil), e.silences...)
+}
+
+func (e *Engine) silenced(rule string, now time.Time) bool {
+	for _, s := range e.silences {
+		if (s.Rule == rule || s.Rule == "*") && now.Before(s.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) updateSilenced(now time.Time) {
+	for _, alert := range e.alerts {
+		alert.Silenced = e.silenced(alert.Rule, now)
+	}
+}
+
+func (e *Engine) expireSilences(now time.Time) {
+	active := e.silences[:0]
+	for _, s := range e.silences {
+		if now.Before(s.Until) {
+			active = append(active, s)
+		}
+	}
+	e.silences = active
+}
+
+func alertKey(rule string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(rule)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "=" + labels[k])
+	}
+	return b.String()
+}
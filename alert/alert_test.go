@@ -0,0 +1,152 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+func TestEngine(t *testing.T) {
+	var mutex sync.Mutex
+	var received []Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Alerts []Alert }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		mutex.Lock()
+		received = append(received, body.Alerts...)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	e, err := NewEngine(&Config{
+		Rules: []Rule{
+			{Name: "LowSnr", Condition: "downstream_snr_below", Threshold: 30, For: 2 * time.Minute},
+			{Name: "RegistrationFailed", Condition: "registration_failed"},
+		},
+		Notifiers: []NotifierConfig{{Type: "webhook", Url: server.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := collector.NewStatus()
+	poll := func(now time.Time, snr float64) []Alert {
+		since := time.Now()
+		status.Set(collector.SectionDownstream, []collector.DownstreamInfo{
+			{ChannelId: 1, Snr: 36}, {ChannelId: 2, Snr: snr},
+		}, nil)
+		mutex.Lock()
+		received = nil
+		mutex.Unlock()
+		e.Evaluate(status, since, now)
+		mutex.Lock()
+		defer mutex.Unlock()
+		return received
+	}
+
+	start := time.Now()
+	if sent := poll(start, 28); len(sent) != 0 {
+		t.Errorf("expected no notification while pending, got %+v", sent)
+	}
+	if alerts := e.Alerts(); len(alerts) != 1 || alerts[0].State != StatePending || alerts[0].Labels["channel_id"] != "2" {
+		t.Errorf("expected one pending alert for channel 2, got %+v", alerts)
+	}
+	sent := poll(start.Add(2*time.Minute), 27)
+	if len(sent) != 1 || sent[0].State != StateFiring || sent[0].Value != 27 {
+		t.Errorf("expected firing notification, got %+v", sent)
+	}
+	if sent := poll(start.Add(3*time.Minute), 27); len(sent) != 0 {
+		t.Errorf("expected a single firing notification, got %+v", sent)
+	}
+
+	// registration_failed has no data in these polls, so it must stay quiet
+	for _, alert := range e.Alerts() {
+		if alert.Rule == "RegistrationFailed" {
+			t.Errorf("unexpected alert %+v", alert)
+		}
+	}
+
+	// silences only suppress notifications while they last
+	id := e.Silence("LowSnr", time.Now().Add(time.Hour), "maintenance")
+	if alerts := e.Alerts(); !alerts[0].Silenced {
+		t.Errorf("expected alert to be silenced, got %+v", alerts)
+	}
+	if !e.Expire(id) {
+		t.Error("expected silence to be expired")
+	}
+	sent = poll(start.Add(4*time.Minute), 35)
+	if len(sent) != 1 || sent[0].State != StateResolved {
+		t.Errorf("expected resolved notification, got %+v", sent)
+	}
+	if alerts := e.Alerts(); len(alerts) != 0 {
+		t.Errorf("expected no alerts, got %+v", alerts)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "alerts.yml")
+	os.WriteFile(file, []byte(`
+rules:
+  - name: LowSnr
+    condition: downstream_snr_below
+    threshold: 30
+    for: 10m
+notifiers:
+  - type: ntfy
+    url: https://ntfy.sh/hitron
+`), 0644)
+	config, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Rules[0].For != 10*time.Minute || config.Notifiers[0].Type != "ntfy" {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	os.WriteFile(file, []byte(`rules: [{name: X, condition: snr_too_low}]`), 0644)
+	if _, err := LoadConfig(file); err == nil {
+		t.Error("expected unknown condition to be rejected")
+	}
+}
+
+func TestLanDevicesChangedFor(t *testing.T) {
+	rule := Rule{Name: "DevicesJumped", Condition: "lan_devices_changed", Threshold: 1, For: time.Minute}
+	if _, err := NewEngine(&Config{Rules: []Rule{rule}}); err == nil {
+		t.Error("expected lan_devices_changed with for to be rejected")
+	}
+
+	rule.For = 0
+	rule.Threshold = 0
+	if _, err := NewEngine(&Config{Rules: []Rule{rule}}); err == nil {
+		t.Error("expected lan_devices_changed without a threshold to be rejected")
+	}
+
+	rule.Threshold = 1
+	e, err := NewEngine(&Config{Rules: []Rule{rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	status := collector.NewStatus()
+	status.Set(collector.SectionConnectInfo, []collector.ConnectInfo{{MacAddr: "68:DB:F5:F4:40:59"}}, nil)
+	e.Evaluate(status, now, now)
+	status.Set(collector.SectionConnectInfo, []collector.ConnectInfo{{MacAddr: "68:DB:F5:F4:40:59"}, {MacAddr: "68:DB:F5:F4:40:5A"}}, nil)
+	e.Evaluate(status, now, now.Add(time.Minute))
+	if alerts := e.Alerts(); len(alerts) != 1 || alerts[0].State != StateFiring {
+		t.Errorf("expected a firing alert, got %+v", alerts)
+	}
+
+	// the next poll without a change resolves it
+	e.Evaluate(status, now, now.Add(2*time.Minute))
+	if alerts := e.Alerts(); len(alerts) != 0 {
+		t.Errorf("expected no alert without a change, got %+v", alerts)
+	}
+}
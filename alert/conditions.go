@@ -0,0 +1,175 @@
+package alert
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// instance is one match of a condition.
+type instance struct {
+	labels  map[string]string
+	value   float64
+	summary string
+}
+
+// condition returns the current matches of rule, and false if the poll
+// didn't fetch the data the condition needs.
+type condition func(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool)
+
+// conditions are the conditions rules can use.
+var conditions = map[string]condition{
+	"login_failed":         loginFailed,
+	"registration_failed":  registrationFailed,
+	"downstream_snr_below": downstreamSnrBelow,
+	"upstream_power_above": upstreamPowerAbove,
+	"channel_critical":     channelCritical,
+	"lan_devices_changed":  lanDevicesChanged,
+}
+
+func conditionNames() []string {
+	names := make([]string, 0, len(conditions))
+	for name := range conditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fresh returns the data of a section fetched in this poll.
+func fresh[T any](status *collector.Status, section string, since time.Time) (T, bool) {
+	data, t, ok := collector.Latest[T](status, section)
+	return data, ok && !t.Before(since)
+}
+
+func loginFailed(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool) {
+	section, ok := status.Get(collector.SectionLogin)
+	switch {
+	case !ok:
+		return nil, false
+	case !section.ErrorTime.Before(since):
+		return []instance{{value: 1, summary: "Login failed: " + section.Error}}, true
+	case !section.Time.Before(since):
+		return nil, true
+	}
+	return nil, false
+}
+
+func registrationFailed(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool) {
+	cmInit, ok := fresh[*collector.CMInit](status, collector.SectionCMInit, since)
+	if !ok {
+		return nil, false
+	}
+	if cmInit.Registration == collector.StatusSuccess {
+		return nil, true
+	}
+	return []instance{{value: 1, summary: "DOCSIS registration is " + strconv.Quote(cmInit.Registration)}}, true
+}
+
+func downstreamSnrBelow(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool) {
+	downstream, ok := fresh[[]collector.DownstreamInfo](status, collector.SectionDownstream, since)
+	if !ok {
+		return nil, false
+	}
+	var matches []instance
+	for _, ch := range downstream {
+		if ch.Snr < rule.Threshold {
+			matches = append(matches, instance{
+				labels:  channelLabels("downstream", ch.ChannelId),
+				value:   ch.Snr,
+				summary: fmt.Sprintf("SNR of downstream channel %d is %.1f dB, below %g dB", ch.ChannelId, ch.Snr, rule.Threshold),
+			})
+		}
+	}
+	return matches, true
+}
+
+func upstreamPowerAbove(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool) {
+	upstream, ok := fresh[[]collector.UpstreamInfo](status, collector.SectionUpstream, since)
+	if !ok {
+		return nil, false
+	}
+	var matches []instance
+	for _, ch := range upstream {
+		if ch.SignalStrength > rule.Threshold {
+			matches = append(matches, instance{
+				labels:  channelLabels("upstream", ch.ChannelId),
+				value:   ch.SignalStrength,
+				summary: fmt.Sprintf("Power of upstream channel %d is %.1f dBmV, above %g dBmV", ch.ChannelId, ch.SignalStrength, rule.Threshold),
+			})
+		}
+	}
+	return matches, true
+}
+
+// channelCritical matches channels rated critical by the health profile.
+func channelCritical(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool) {
+	profile := e.Health
+	if profile == nil {
+		profile = &collector.DefaultHealthProfile
+	}
+	downstream, ok := fresh[[]collector.DownstreamInfo](status, collector.SectionDownstream, since)
+	if !ok {
+		return nil, false
+	}
+	upstream, ok := fresh[[]collector.UpstreamInfo](status, collector.SectionUpstream, since)
+	if !ok {
+		return nil, false
+	}
+	var matches []instance
+	for _, ch := range downstream {
+		if profile.Downstream(ch) == collector.HealthCritical {
+			matches = append(matches, instance{
+				labels: channelLabels("downstream", ch.ChannelId),
+				value:  float64(collector.HealthCritical),
+				summary: fmt.Sprintf("Downstream channel %d is critical: %.1f dBmV, SNR %.1f dB",
+					ch.ChannelId, ch.SignalStrength, ch.Snr),
+			})
+		}
+	}
+	for _, ch := range upstream {
+		if profile.Upstream(ch) == collector.HealthCritical {
+			matches = append(matches, instance{
+				labels:  channelLabels("upstream", ch.ChannelId),
+				value:   float64(collector.HealthCritical),
+				summary: fmt.Sprintf("Upstream channel %d is critical: %.1f dBmV", ch.ChannelId, ch.SignalStrength),
+			})
+		}
+	}
+	return matches, true
+}
+
+// lanDevicesChanged matches if the number of distinct LAN devices changed by
+// at least the threshold since the previous poll.
+func lanDevicesChanged(e *Engine, rule *Rule, status *collector.Status, since time.Time) ([]instance, bool) {
+	devices, ok := fresh[[]collector.ConnectInfo](status, collector.SectionConnectInfo, since)
+	if !ok {
+		return nil, false
+	}
+	macs := map[string]bool{}
+	for _, device := range devices {
+		macs[strings.ToUpper(device.MacAddr)] = true
+	}
+	previous, ok := e.lastDevices[rule.Name]
+	e.lastDevices[rule.Name] = len(macs)
+	if !ok {
+		return nil, true
+	}
+	change := float64(len(macs) - previous)
+	if math.Abs(change) < rule.Threshold {
+		return nil, true
+	}
+	return []instance{{
+		value:   change,
+		summary: fmt.Sprintf("Number of LAN devices changed from %d to %d", previous, len(macs)),
+	}}, true
+}
+
+func channelLabels(direction string, channelId int) map[string]string {
+	return map[string]string{"direction": direction, "channel_id": strconv.Itoa(channelId)}
+}
@@ -0,0 +1,181 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Notifier sends notifications for alerts which started firing or resolved.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// NotifierConfig configures one notification target.
+type NotifierConfig struct {
+	Type string `yaml:"type"` // webhook, ntfy or smtp
+
+	// webhook and ntfy
+	Url         string            `yaml:"url"`
+	Headers     map[string]string `yaml:"headers"`
+	BearerToken string            `yaml:"bearer_token"`
+
+	// smtp
+	Host     string   `yaml:"host"` // host:port
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+func (c NotifierConfig) build() (Notifier, error) {
+	switch c.Type {
+	case "webhook":
+		if c.Url == "" {
+			return nil, errors.New("webhook notifier: url is required")
+		}
+		return &Webhook{Url: c.Url, Headers: c.headers()}, nil
+	case "ntfy":
+		if c.Url == "" {
+			return nil, errors.New("ntfy notifier: url is required")
+		}
+		return &Ntfy{Url: c.Url, Headers: c.headers()}, nil
+	case "smtp":
+		if c.Host == "" || c.From == "" || len(c.To) == 0 {
+			return nil, errors.New("smtp notifier: host, from and to are required")
+		}
+		return &SMTP{Host: c.Host, Username: c.Username, Password: c.Password, From: c.From, To: c.To}, nil
+	}
+	return nil, errors.New("unknown notifier type '" + c.Type + "'")
+}
+
+func (c NotifierConfig) headers() map[string]string {
+	headers := map[string]string{}
+	for k, v := range c.Headers {
+		headers[k] = v
+	}
+	if c.BearerToken != "" {
+		headers["Authorization"] = "Bearer " + c.BearerToken
+	}
+	return headers
+}
+
+// Webhook posts the alerts as JSON: {"alerts": [...]}.
+type Webhook struct {
+	Url     string
+	Headers map[string]string
+}
+
+func (w *Webhook) Notify(ctx context.Context, alerts []Alert) error {
+	body, err := json.Marshal(struct {
+		Alerts []Alert `json:"alerts"`
+	}{alerts})
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Url, "application/json", body, w.Headers)
+}
+
+// Ntfy posts one plain text message per alert, as ntfy.sh and similar
+// push services expect.
+type Ntfy struct {
+	Url     string
+	Headers map[string]string
+}
+
+func (n *Ntfy) Notify(ctx context.Context, alerts []Alert) error {
+	for _, alert := range alerts {
+		headers := map[string]string{"Title": title(alert)}
+		if alert.State == StateFiring && alert.Severity == "critical" {
+			headers["Priority"] = "high"
+		}
+		if alert.State == StateResolved {
+			headers["Tags"] = "white_check_mark"
+		} else {
+			headers["Tags"] = "warning"
+		}
+		for k, v := range n.Headers {
+			headers[k] = v
+		}
+		if err := post(ctx, n.Url, "text/plain", []byte(alert.Summary), headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SMTP sends one mail per poll listing all alerts.
+type SMTP struct {
+	Host     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (s *SMTP) Notify(ctx context.Context, alerts []Alert) error {
+	subject := title(alerts[0])
+	if len(alerts) > 1 {
+		subject = fmt.Sprintf("[hitron] %d alerts changed", len(alerts))
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n",
+		s.From, strings.Join(s.To, ", "), subject, time.Now().Format(time.RFC1123Z))
+	for _, alert := range alerts {
+		fmt.Fprintf(&body, "%s\r\n  %s\r\n  since %s\r\n\r\n", title(alert), alert.Summary,
+			alert.ActiveAt.Format(time.RFC3339))
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Host)
+		if err != nil {
+			return errors.Wrap(err, "smtp host")
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	// net/smtp has no context support, so the timeout only applies to the other notifiers
+	return errors.Wrap(smtp.SendMail(s.Host, auth, s.From, s.To, []byte(body.String())), "sending mail")
+}
+
+func title(alert Alert) string {
+	var labels []string
+	for k, v := range alert.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	t := "[hitron] " + strings.ToUpper(string(alert.State)) + " " + alert.Rule
+	if len(labels) > 0 {
+		t += " (" + strings.Join(labels, ", ") + ")"
+	}
+	return t
+}
+
+func post(ctx context.Context, url, contentType string, body []byte, headers map[string]string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		request.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "posting to "+url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("posting to " + url + ": " + resp.Status)
+	}
+	return nil
+}
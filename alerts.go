@@ -0,0 +1,97 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/cfstras/hitron-exporter/alert"
+)
+
+//go:embed templates/alerts.html
+var alertsTemplateText string
+
+var alertsTemplate = template.Must(template.New("alerts").Parse(alertsTemplateText))
+
+// alerts is set if --alert-rules is configured.
+var alerts *alert.Engine
+
+type alertsPage struct {
+	Now      time.Time
+	Alerts   []alert.Alert
+	Silences []alert.Silence
+	Rules    []alert.Rule
+}
+
+// setupAlerts loads --alert-rules and evaluates them after every push poll.
+func setupAlerts() {
+	path := viper.GetString("alert-rules")
+	if path == "" {
+		return
+	}
+	config, err := alert.LoadConfig(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	alerts, err = alert.NewEngine(config)
+	if err != nil {
+		log.Fatalln("Alerts:", err)
+	}
+	alerts.Health = healthProfile
+	pushOutputs = append(pushOutputs, func(since time.Time, _ []*dto.MetricFamily) {
+		alerts.Evaluate(status, since, time.Now())
+	})
+	log.Infof("Evaluating %d alert rules", len(config.Rules))
+}
+
+func handleAlertsPage(w http.ResponseWriter, request *http.Request) {
+	page := alertsPage{
+		Now:      time.Now(),
+		Alerts:   alerts.Alerts(),
+		Silences: alerts.Silences(),
+		Rules:    alerts.Rules,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := alertsTemplate.Execute(w, page); err != nil {
+		log.Warn("Rendering alerts page: ", err)
+	}
+}
+
+func handleAlertsRequest(w http.ResponseWriter, request *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"alerts":   alerts.Alerts(),
+		"silences": alerts.Silences(),
+	})
+}
+
+// handleSilenceRequest adds a silence from the form fields rule, duration and comment.
+func handleSilenceRequest(w http.ResponseWriter, request *http.Request) {
+	duration, err := time.ParseDuration(request.FormValue("duration"))
+	if err != nil || duration <= 0 {
+		http.Error(w, "invalid duration", http.StatusBadRequest)
+		return
+	}
+	rule := request.FormValue("rule")
+	if rule == "" {
+		http.Error(w, "rule is required", http.StatusBadRequest)
+		return
+	}
+	id := alerts.Silence(rule, time.Now().Add(duration), request.FormValue("comment"))
+	log.Infof("Silenced %s for %s (silence %d)", rule, duration, id)
+	http.Redirect(w, request, "/alerts", http.StatusSeeOther)
+}
+
+func handleExpireSilenceRequest(w http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || !alerts.Expire(id) {
+		http.Error(w, "unknown silence", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, request, "/alerts", http.StatusSeeOther)
+}
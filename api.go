@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+var refreshMutex sync.Mutex
+
+type statusResponse struct {
+	Updated  time.Time                    `json:"updated"`
+	Sections map[string]collector.Section `json:"sections"`
+}
+
+// refreshStatus polls the router unless status is younger than --api-max-age.
+// Concurrent callers wait for a single poll.
+func refreshStatus() {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+	if time.Since(status.Updated()) < viper.GetDuration("api-max-age") {
+		return
+	}
+	log.Debug("Status is stale, polling router")
+	newCollector().Refresh()
+}
+
+func handleStatusRequest(w http.ResponseWriter, request *http.Request) {
+	refreshStatus()
+	writeStatusJSON(w, statusResponse{
+		Updated:  status.Updated(),
+		Sections: status.Sections(),
+	})
+}
+
+func handleSectionRequest(w http.ResponseWriter, request *http.Request) {
+	refreshStatus()
+	section, ok := status.Get(request.PathValue("section"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown section"})
+		return
+	}
+	writeStatusJSON(w, section)
+}
+
+// writeStatusJSON writes router data with the identifying values redacted
+// like the metric labels.
+func writeStatusJSON(w http.ResponseWriter, data interface{}) {
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		log.Warn("Encoding status: ", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(redactor.RedactJSON(out))
+	w.Write([]byte("\n"))
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		log.Warn("Writing JSON response: ", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// fetchRuleSet logs in once and reads the live port forwarding, DMZ and firewall rules.
+func fetchRuleSet() (*collector.RuleSet, error) {
+	var rules *collector.RuleSet
+	err := withSession(func(session *collector.Session) error {
+		var err error
+		rules, err = session.RuleSet()
+		return err
+	})
+	return rules, err
+}
+
+// writeBaseline saves the live rule set as a YAML baseline.
+func writeBaseline(path string) {
+	rules, err := fetchRuleSet()
+	if err != nil {
+		log.Errorln("fetching rules:", err)
+		os.Exit(2)
+	}
+	data, err := yaml.Marshal(rules)
+	if err != nil {
+		log.Errorln("encoding baseline:", err)
+		os.Exit(2)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Errorln("writing baseline:", err)
+		os.Exit(2)
+	}
+	log.Infoln("Wrote baseline to", path)
+}
+
+// diffBaseline compares the live rule set against a YAML baseline and exits
+// with 0 if they match, 1 on drift and 2 on errors.
+func diffBaseline(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Errorln("reading baseline:", err)
+		os.Exit(2)
+	}
+	var baseline collector.RuleSet
+	if err := yaml.Unmarshal(data, &baseline); err != nil {
+		log.Errorln("parsing baseline:", err)
+		os.Exit(2)
+	}
+	rules, err := fetchRuleSet()
+	if err != nil {
+		log.Errorln("fetching rules:", err)
+		os.Exit(2)
+	}
+	diff := rules.Diff(&baseline)
+	if len(diff) == 0 {
+		fmt.Println("no drift")
+		return
+	}
+	for _, line := range diff {
+		fmt.Println(line)
+	}
+	os.Exit(1)
+}
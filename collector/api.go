@@ -8,6 +8,7 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -28,6 +29,7 @@ type Session struct {
 }
 
 type SysInfo struct {
+	ModelName       string `json:"modelName"`       // CGNV4-FX2, missing on some firmwares
 	HwVersion       string `json:"hwVersion"`       // 1A
 	SwVersion       string `json:"swVersion"`       // 4.12.34.567-XX-YYY
 	SerialNumber    string `json:"serialNumber"`    // VCAP12345678
@@ -47,6 +49,25 @@ type SysInfo struct {
 	LSendPkt        string `json:"LSendPkt"`        // 1.15G Bytes
 }
 
+// Uptime returns the system uptime in seconds, or -1 if it can't be parsed.
+func (i *SysInfo) Uptime() float64 {
+	return parseDuration(i.SystemUptime)
+}
+
+// Traffic returns the bytes received and sent on the "lan" or "wan" interface,
+// or -1 if they can't be parsed.
+func (i *SysInfo) Traffic(iface string) (recv, send float64) {
+	if iface == "lan" {
+		return parsePkt(i.LRecPkt), parsePkt(i.LSendPkt)
+	}
+	return parsePkt(i.WRecPkt), parsePkt(i.WSendPkt)
+}
+
+// HasDelegatedPrefix reports whether the router got an IPv6 prefix delegated.
+func (i *SysInfo) HasDelegatedPrefix() bool {
+	return normalizePrefix(i.DelegatedPrefix) != ""
+}
+
 type CMInit struct {
 	HwInit         string `json:"hwInit"`         // Success
 	FindDownstream string `json:"findDownstream"` // Success
@@ -83,14 +104,34 @@ type Modulation int
 
 var (
 	Modulation_16QAM   Modulation = 0
-	Modulation_64QAM              = 1
-	Modulation_256QAM             = 2
-	Modulation_1024QAM            = 3
-	Modulation_32QAM              = 4
-	Modulation_128QAM             = 5
-	Modulation_QPSK               = 6
+	Modulation_64QAM   Modulation = 1
+	Modulation_256QAM  Modulation = 2
+	Modulation_1024QAM Modulation = 3
+	Modulation_32QAM   Modulation = 4
+	Modulation_128QAM  Modulation = 5
+	Modulation_QPSK    Modulation = 6
 )
 
+func (m Modulation) String() string {
+	switch m {
+	case Modulation_16QAM:
+		return "16QAM"
+	case Modulation_64QAM:
+		return "64QAM"
+	case Modulation_256QAM:
+		return "256QAM"
+	case Modulation_1024QAM:
+		return "1024QAM"
+	case Modulation_32QAM:
+		return "32QAM"
+	case Modulation_128QAM:
+		return "128QAM"
+	case Modulation_QPSK:
+		return "QPSK"
+	}
+	return fmt.Sprintf("unknown(%d)", int(m))
+}
+
 type DownstreamInfo struct {
 	PortId         int        `json:"portId,string"`         // 1
 	Frequency      int64      `json:"frequency,string"`      // 474000000
@@ -119,13 +160,81 @@ type ConnectInfo struct {
 	Comnum      int         `json:"comnum"`      // 1
 }
 
+type WirelessRadio struct {
+	Band         string `json:"band"`           // 2.4G / 5G
+	WlsEnable    string `json:"wlsEnable"`      // ON
+	Channel      int    `json:"channel,string"` // 6
+	Bandwidth    string `json:"bandwidth"`      // 20MHz / 80MHz
+	WlsMode      string `json:"wlsMode"`        // 802.11b/g/n
+	SsidName     string `json:"ssidName"`       // MyWifi
+	SsidEnable   string `json:"ssidEnable"`     // ON
+	SecurityMode string `json:"securityMode"`   // WPA2-PSK
+}
+
+type WirelessClient struct {
+	Band     string  `json:"band"`           // 5G
+	Ssid     string  `json:"ssid"`           // MyWifi
+	MacAddr  string  `json:"macAddr"`        // 68:DB:F5:F4:40:59
+	IpAddr   string  `json:"ipAddr"`         // 192.168.0.21
+	HostName string  `json:"hostName"`       // unknown
+	Rssi     float64 `json:"rssi,string"`    // -57
+	PhyRate  float64 `json:"phyRate,string"` // 866 (Mbit/s)
+	PhyMode  string  `json:"phyMode"`        // 11ac
+}
+
+type DhcpSetting struct {
+	DhcpEnable string `json:"dhcpEnable"`       // ON
+	LanIp      string `json:"lanIp"`            // 192.168.0.1
+	SubnetMask string `json:"subnetMask"`       // 255.255.255.0
+	StartIp    string `json:"startIp"`          // 192.168.0.10
+	EndIp      string `json:"endIp"`            // 192.168.0.254
+	LeaseTime  int    `json:"leaseTime,string"` // 86400 (seconds)
+}
+
+type DhcpLease struct {
+	Id       int    `json:"id"`       // 1
+	HostName string `json:"hostName"` // unknown
+	IpAddr   string `json:"ipAddr"`   // 192.168.0.21
+	MacAddr  string `json:"macAddr"`  // 68:DB:F5:F4:40:59
+	Expires  string `json:"expires"`  // 00 Days,23 Hours,12 Minutes,05 Seconds
+}
+
+type MtaStatus struct {
+	MtaDhcp         string `json:"mtaDhcp"`         // Success
+	MtaSecurity     string `json:"mtaSecurity"`     // Success
+	MtaTftp         string `json:"mtaTftp"`         // Success
+	MtaProvisioning string `json:"mtaProvisioning"` // Success
+	MtaIpAddress    string `json:"mtaIpAddress"`    // 10.50.12.34
+	MtaMac          string `json:"mtaMac"`          // 68:8F:12:34:12:36
+}
+
+type MtaLine struct {
+	LineNum   int    `json:"lineNum,string"` // 1
+	RegStatus string `json:"regStatus"`      // Registered
+	HookState string `json:"hookState"`      // On-hook / Off-hook
+}
+
+type EventLogEntry struct {
+	Index    int    `json:"index"`    // 1
+	Time     string `json:"time"`     // 04/03/2021 14:16:41
+	Type     string `json:"type"`     // 82000200
+	Priority string `json:"priority"` // critical
+	Event    string `json:"event"`    // No Ranging Response received - T3 time-out;CM-MAC=...
+}
+
 var (
 	StatusSuccess          = "Success"
 	NetworkAccessPermitted = "Permitted"
+	WirelessOn             = "ON"
+	DhcpOn                 = "ON"
+	RuleOn                 = "ON"
+	MtaLineRegistered      = "Registered"
+	MtaLineOffHook         = "Off-hook"
 
 	contentType = "application/x-www-form-urlencoded"
 
 	ErrorBackingOff  = errors.New("Backing off, because the router told us to do so")
+	ErrorTokenBusy   = errors.New("Timed out waiting for a previous session to end")
 	ErrorLoginAnswer = errors.New("Login response unknown")
 
 	// Time to wait for a previous session to end before failing a scrape.
@@ -134,8 +243,37 @@ var (
 	RequestTimeout = time.Second * 30
 
 	accessToken chan bool
+	// backoffUntil is the UnixNano time the router's login lock ends.
+	backoffUntil atomic.Int64
 )
 
+// Endpoint is a /data/*.asp endpoint and the type its JSON decodes into.
+type Endpoint struct {
+	Name string
+	New  func() interface{}
+}
+
+// Endpoints lists every endpoint the collector reads.
+var Endpoints = []Endpoint{
+	{"getSysInfo", func() interface{} { return &[]SysInfo{} }},
+	{"getCMInit", func() interface{} { return &[]CMInit{} }},
+	{"getCmDocsisWan", func() interface{} { return &[]CMDocsisWAN{} }},
+	{"getConnectInfo", func() interface{} { return &[]ConnectInfo{} }},
+	{"dsinfo", func() interface{} { return &[]DownstreamInfo{} }},
+	{"usinfo", func() interface{} { return &[]UpstreamInfo{} }},
+	{"getWirelessStatus", func() interface{} { return &[]WirelessRadio{} }},
+	{"getWirelessClient", func() interface{} { return &[]WirelessClient{} }},
+	{"getLanDhcpSetting", func() interface{} { return &[]DhcpSetting{} }},
+	{"getDhcpLease", func() interface{} { return &[]DhcpLease{} }},
+	{"getCmEventLog", func() interface{} { return &[]EventLogEntry{} }},
+	{"getSysLog", func() interface{} { return &[]EventLogEntry{} }},
+	{"getForwardingRules", func() interface{} { return &[]PortForwardRule{} }},
+	{"getDmz", func() interface{} { return &[]DmzSetting{} }},
+	{"getFirewallRules", func() interface{} { return &[]FirewallRule{} }},
+	{"getMtaStatus", func() interface{} { return &[]MtaStatus{} }},
+	{"getMtaLineStatus", func() interface{} { return &[]MtaLine{} }},
+}
+
 func init() {
 	accessToken = make(chan bool, 1)
 	accessToken <- true
@@ -166,7 +304,10 @@ func (r *HitronRouter) Login() (*Session, error) {
 	// get a backoff token
 	session := &Session{r}
 	if t := session.getToken(); !t {
-		return nil, ErrorBackingOff
+		if time.Now().UnixNano() < backoffUntil.Load() {
+			return nil, ErrorBackingOff
+		}
+		return nil, ErrorTokenBusy
 	}
 
 	// login check to get preSession cookie
@@ -194,6 +335,7 @@ func (r *HitronRouter) Login() (*Session, error) {
 		strings.NewReader(form.Encode()))
 	if err != nil {
 		log.Warnf("Login error: %+v / %+v", err, resp)
+		session.abort()
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -218,14 +360,17 @@ func (r *HitronRouter) handleLoginError(session *Session, response string) error
 			session.abort()
 			return errors.New("parsing backoff '" + response + "': " + err.Error())
 		}
+		backoff := time.Minute*minutes + time.Second*seconds
+		backoffUntil.Store(time.Now().Add(backoff).UnixNano())
 		go func() {
-			wait := time.After(time.Minute*minutes + time.Second*seconds)
+			wait := time.After(backoff)
 			<-wait
 			session.abort()
 		}()
 		return ErrorBackingOff
 	}
 
+	session.abort()
 	return errors.Wrap(ErrorLoginAnswer, response)
 }
 
@@ -254,6 +399,7 @@ func (r *Session) Logout() {
 		return
 	}
 	// body should be empty
+	resp.Body.Close()
 }
 
 func (r *HitronRouter) getCookie(name string) string {
@@ -267,20 +413,32 @@ func (r *HitronRouter) getCookie(name string) string {
 	return ""
 }
 
-func (r *HitronRouter) fetch(name string, output interface{}) error {
+// FetchRaw returns the body of /data/<name>.asp.
+func (r *HitronRouter) FetchRaw(name string) ([]byte, error) {
 	resp, err := r.client.Get(r.URL + "/data/" + name + ".asp")
 	if err != nil {
-		return errors.Wrap(err, "getting "+name)
+		return nil, errors.Wrap(err, "getting "+name)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("getting " + name + ": " + resp.Status)
+	}
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Debugf("%s raw: %+v : %v", name, resp, string(data))
 	if strings.Contains(string(data), "Unknown error.") {
 		//TODO
 	}
+	return data, nil
+}
+
+func (r *HitronRouter) fetch(name string, output interface{}) error {
+	data, err := r.FetchRaw(name)
+	if err != nil {
+		return err
+	}
 	err = json.Unmarshal(data, output)
 	if err != nil {
 		return errors.Wrap(err, "parsing "+name)
@@ -341,3 +499,104 @@ func (r *HitronRouter) DownstreamInfo() ([]DownstreamInfo, error) {
 	err := r.fetch("dsinfo", &data)
 	return data, err
 }
+
+func (r *HitronRouter) WirelessStatus() ([]WirelessRadio, error) {
+	var data []WirelessRadio
+	err := r.fetch("getWirelessStatus", &data)
+	return data, err
+}
+
+func (r *HitronRouter) WirelessClients() ([]WirelessClient, error) {
+	var data []WirelessClient
+	err := r.fetch("getWirelessClient", &data)
+	return data, err
+}
+
+func (r *HitronRouter) DhcpSetting() (*DhcpSetting, error) {
+	var data []DhcpSetting
+	err := r.fetch("getLanDhcpSetting", &data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1 {
+		return nil, errors.New(fmt.Sprintf("DhcpSetting gave wrong length: %d", len(data)))
+	}
+	return &data[0], err
+}
+
+func (r *HitronRouter) DhcpLeases() ([]DhcpLease, error) {
+	var data []DhcpLease
+	err := r.fetch("getDhcpLease", &data)
+	return data, err
+}
+
+func (r *HitronRouter) DocsisEventLog() ([]EventLogEntry, error) {
+	var data []EventLogEntry
+	err := r.fetch("getCmEventLog", &data)
+	return data, err
+}
+
+func (r *HitronRouter) SystemEventLog() ([]EventLogEntry, error) {
+	var data []EventLogEntry
+	err := r.fetch("getSysLog", &data)
+	return data, err
+}
+
+func (r *HitronRouter) PortForwardRules() ([]PortForwardRule, error) {
+	var data []PortForwardRule
+	err := r.fetch("getForwardingRules", &data)
+	return data, err
+}
+
+func (r *HitronRouter) Dmz() (*DmzSetting, error) {
+	var data []DmzSetting
+	err := r.fetch("getDmz", &data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1 {
+		return nil, errors.New(fmt.Sprintf("Dmz gave wrong length: %d", len(data)))
+	}
+	return &data[0], err
+}
+
+func (r *HitronRouter) FirewallRules() ([]FirewallRule, error) {
+	var data []FirewallRule
+	err := r.fetch("getFirewallRules", &data)
+	return data, err
+}
+
+// RuleSet fetches port forwards, DMZ and firewall rules.
+func (r *HitronRouter) RuleSet() (*RuleSet, error) {
+	forwards, err := r.PortForwardRules()
+	if err != nil {
+		return nil, err
+	}
+	dmz, err := r.Dmz()
+	if err != nil {
+		return nil, err
+	}
+	firewall, err := r.FirewallRules()
+	if err != nil {
+		return nil, err
+	}
+	return &RuleSet{PortForwards: forwards, Dmz: *dmz, Firewall: firewall}, nil
+}
+
+func (r *HitronRouter) MtaStatus() (*MtaStatus, error) {
+	var data []MtaStatus
+	err := r.fetch("getMtaStatus", &data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1 {
+		return nil, errors.New(fmt.Sprintf("MtaStatus gave wrong length: %d", len(data)))
+	}
+	return &data[0], err
+}
+
+func (r *HitronRouter) MtaLines() ([]MtaLine, error) {
+	var data []MtaLine
+	err := r.fetch("getMtaLineStatus", &data)
+	return data, err
+}
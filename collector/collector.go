@@ -1,18 +1,45 @@
 package collector
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
+	"net/netip"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	prom "github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/cfstras/hitron-exporter/oui"
 )
 
 type Collector struct {
 	Router *HitronRouter
+	// OUI resolves device MACs to vendor names. oui.Default is used if nil.
+	OUI *oui.DB
+	// Redactor rewrites identifying labels. Nothing is redacted if nil.
+	Redactor *Redactor
+	// MaxLanDevices caps the number of distinct MACs exported from the LAN
+	// device table. Zero means no limit.
+	MaxLanDevices int
+	// Events tracks the router's event logs between scrapes.
+	// Event logs are not collected if nil.
+	Events *EventLog
+	// Prefix detects delegated IPv6 prefix changes between scrapes.
+	// Changes are not tracked if nil.
+	Prefix *PrefixTracker
+	// Status receives the decoded data of every section. May be nil.
+	Status *Status
+	// Extra are configured endpoints without a hand-written struct.
+	Extra []ExtraEndpoint
+	// Health rates the channels. DefaultHealthProfile is used if nil.
+	Health *HealthProfile
+	// ScrapeDuration observes the scrape time of every component across
+	// scrapes, see NewScrapeDuration. May be nil.
+	ScrapeDuration *prom.HistogramVec
 }
 
 const prefix = "hitron_"
@@ -20,6 +47,8 @@ const prefix = "hitron_"
 var (
 	loginSuccessDesc *prom.Desc = prom.NewDesc(
 		prefix+"login_success_bool", "1 if the login was successful", nil, nil)
+	loginBackoffDesc = prom.NewDesc(
+		prefix+"login_backoff_active", "1 if the router locked the login after failed attempts", nil, nil)
 	scrapeTimeDesc *prom.Desc = prom.NewDesc(
 		prefix+"scrape_time", "Time the scrape run took", []string{"component"}, nil)
 
@@ -35,6 +64,11 @@ var (
 	trafficDesc = prom.NewDesc(
 		prefix+"traffic", "Basic traffic counters. if=wan/lan, dir=send/recv.",
 		[]string{"if", "dir"}, nil)
+	ipv6InfoDesc = prom.NewDesc(
+		prefix+"ipv6_info", "IPv6 and DS-Lite state in labels",
+		[]string{"aftr_name", "aftr_addr", "delegated_prefix", "lan_ipv6_addr"}, nil)
+	ipv6PrefixPresentDesc = prom.NewDesc(
+		prefix+"ipv6_delegated_prefix_present", "1 if the router has a delegated IPv6 prefix", nil, nil)
 
 	// CMInit
 	cmHwInitDesc = prom.NewDesc(
@@ -63,13 +97,116 @@ var (
 		prefix+"cm_dhcp_lease_duration", "DOCSIS DHCP Lease duration", nil, nil)
 
 	// ConnectInfo
-	lanDeviceDesc = prom.NewDesc(
-		prefix+"lan_device", "LAN Device table",
-		[]string{"ip", "ip_version", "mac", "ip_type", "interface", "comnum"}, nil)
+	lanDeviceInfoDesc = prom.NewDesc(
+		prefix+"lan_device_info", "LAN Device table, one series per MAC and address",
+		[]string{"mac", "hostname", "ip", "ip_version", "vendor", "ip_type", "interface", "comnum"}, nil)
+	lanDeviceOnlineDesc = prom.NewDesc(
+		prefix+"lan_device_online", "1 if the LAN device is active",
+		[]string{"mac"}, nil)
+	lanDevicesDesc = prom.NewDesc(
+		prefix+"lan_devices", "Number of distinct MACs in the LAN device table", nil, nil)
+	lanDevicesDroppedDesc = prom.NewDesc(
+		prefix+"lan_devices_dropped", "Number of LAN devices not exported because of the device limit", nil, nil)
+
+	// MtaStatus
+	mtaDhcpDesc = prom.NewDesc(
+		prefix+"mta_dhcp_success", "MTA Provisioning DHCP Status", nil, nil)
+	mtaSecurityDesc = prom.NewDesc(
+		prefix+"mta_security_success", "MTA Provisioning Security Status", nil, nil)
+	mtaTftpDesc = prom.NewDesc(
+		prefix+"mta_tftp_success", "MTA Provisioning Config File Download Status", nil, nil)
+	mtaProvisioningDesc = prom.NewDesc(
+		prefix+"mta_provisioning_success", "MTA Provisioning Status", nil, nil)
+	mtaAddressDesc = prom.NewDesc(
+		prefix+"mta_addr", "MTA IP and MAC Address in labels", []string{"ip", "mac"}, nil)
+
+	// MtaLines
+	mtaLineRegisteredDesc = prom.NewDesc(
+		prefix+"mta_line_registered", "1 if the voice line is registered", []string{"line"}, nil)
+	mtaLineOffHookDesc = prom.NewDesc(
+		prefix+"mta_line_off_hook", "1 if the voice line is off hook", []string{"line"}, nil)
+
+	// DhcpSetting, DhcpLeases
+	dhcpEnabledDesc = prom.NewDesc(
+		prefix+"dhcp_enabled", "1 if the LAN DHCP server is enabled", nil, nil)
+	dhcpPoolSizeDesc = prom.NewDesc(
+		prefix+"dhcp_pool_size", "Number of addresses in the DHCP pool", nil, nil)
+	dhcpLeaseTimeDesc = prom.NewDesc(
+		prefix+"dhcp_lease_time_seconds", "Configured DHCP lease time", nil, nil)
+	dhcpLeasesDesc = prom.NewDesc(
+		prefix+"dhcp_leases", "Number of DHCP leases in use", nil, nil)
+	dhcpLeaseRemainingDesc = prom.NewDesc(
+		prefix+"dhcp_lease_remaining_seconds", "Time until a DHCP lease expires",
+		[]string{"mac", "ip"}, nil)
+
+	// RuleSet
+	portForwardRuleDesc = prom.NewDesc(
+		prefix+"port_forward_rule", "Port forwarding rule, 1 if enabled",
+		[]string{"name", "protocol", "public_port", "private_ip", "private_port", "remote_ip"}, nil)
+	dmzEnabledDesc = prom.NewDesc(
+		prefix+"dmz_enabled", "1 if the DMZ host is enabled", []string{"host"}, nil)
+	firewallRuleDesc = prom.NewDesc(
+		prefix+"firewall_rule", "Firewall rule, 1 if enabled",
+		[]string{"name", "direction", "action", "protocol", "src_ip", "dst_ip", "dst_port"}, nil)
+	configRulesHashDesc = prom.NewDesc(
+		prefix+"config_rules_hash", "48 bit hash of port forwarding, DMZ and firewall rules", nil, nil)
+
+	// WirelessStatus
+	wifiRadioInfoDesc = prom.NewDesc(
+		prefix+"wifi_radio_info", "WiFi radio settings in labels",
+		[]string{"band", "ssid", "mode", "security"}, nil)
+	wifiRadioEnabledDesc = prom.NewDesc(
+		prefix+"wifi_radio_enabled", "1 if the WiFi radio is enabled", []string{"band"}, nil)
+	wifiSsidEnabledDesc = prom.NewDesc(
+		prefix+"wifi_ssid_enabled", "1 if the SSID is broadcast", []string{"band", "ssid"}, nil)
+	wifiRadioChannelDesc = prom.NewDesc(
+		prefix+"wifi_radio_channel", "WiFi radio channel number", []string{"band"}, nil)
+	wifiRadioBandwidthDesc = prom.NewDesc(
+		prefix+"wifi_radio_bandwidth_hertz", "WiFi radio channel bandwidth", []string{"band"}, nil)
+
+	// WirelessClients
+	wifiClientsDesc = prom.NewDesc(
+		prefix+"wifi_clients", "Number of associated WiFi clients", []string{"band"}, nil)
+	wifiClientRssiDesc = prom.NewDesc(
+		prefix+"wifi_client_rssi_dbm", "Received signal strength of a WiFi client",
+		[]string{"band", "mac"}, nil)
+	wifiClientPhyRateDesc = prom.NewDesc(
+		prefix+"wifi_client_phy_rate_bps", "Negotiated PHY rate of a WiFi client",
+		[]string{"band", "mac"}, nil)
+
+	// DownstreamInfo
+	downstreamPowerDesc = prom.NewDesc(
+		prefix+"downstream_power_dbmv", "Downstream channel receive power",
+		[]string{"channel_id", "port_id"}, nil)
+	downstreamSnrDesc = prom.NewDesc(
+		prefix+"downstream_snr_db", "Downstream channel signal to noise ratio",
+		[]string{"channel_id", "port_id"}, nil)
+	downstreamFrequencyDesc = prom.NewDesc(
+		prefix+"downstream_frequency_hertz", "Downstream channel center frequency",
+		[]string{"channel_id", "port_id"}, nil)
+
+	// UpstreamInfo
+	upstreamPowerDesc = prom.NewDesc(
+		prefix+"upstream_power_dbmv", "Upstream channel transmit power",
+		[]string{"channel_id", "port_id"}, nil)
+	upstreamFrequencyDesc = prom.NewDesc(
+		prefix+"upstream_frequency_hertz", "Upstream channel center frequency",
+		[]string{"channel_id", "port_id"}, nil)
+	upstreamBandwidthDesc = prom.NewDesc(
+		prefix+"upstream_bandwidth_hertz", "Upstream channel width",
+		[]string{"channel_id", "port_id"}, nil)
+
+	// Channel health
+	channelHealthDesc = prom.NewDesc(
+		prefix+"channel_health", "Channel rating against the health profile: 0 = ok, 1 = warn, 2 = critical",
+		[]string{"direction", "channel_id"}, nil)
+	lineHealthScoreDesc = prom.NewDesc(
+		prefix+"line_health_score", "Share of ok channels from 0 to 100, warn channels count half", nil, nil)
 )
 
 func (c *Collector) Describe(ch chan<- *prom.Desc) {
 	ch <- loginSuccessDesc
+	ch <- loginBackoffDesc
 	ch <- scrapeTimeDesc
 
 	// SysInfo
@@ -77,6 +214,10 @@ func (c *Collector) Describe(ch chan<- *prom.Desc) {
 	ch <- versionDesc
 	ch <- addressDesc
 	ch <- trafficDesc
+	ch <- ipv6InfoDesc
+	ch <- ipv6PrefixPresentDesc
+	ch <- ipv6PrefixChangesDesc
+	ch <- ipv6PrefixLastChangeDesc
 
 	// CMInit
 	ch <- cmHwInitDesc
@@ -93,14 +234,89 @@ func (c *Collector) Describe(ch chan<- *prom.Desc) {
 	ch <- cmIpLeaseDurationDesc
 
 	// ConnectInfo
-	ch <- lanDeviceDesc
-
+	ch <- lanDeviceInfoDesc
+	ch <- lanDeviceOnlineDesc
+	ch <- lanDevicesDesc
+	ch <- lanDevicesDroppedDesc
+
+	// MtaStatus
+	ch <- mtaDhcpDesc
+	ch <- mtaSecurityDesc
+	ch <- mtaTftpDesc
+	ch <- mtaProvisioningDesc
+	ch <- mtaAddressDesc
+
+	// MtaLines
+	ch <- mtaLineRegisteredDesc
+	ch <- mtaLineOffHookDesc
+
+	// DhcpSetting, DhcpLeases
+	ch <- dhcpEnabledDesc
+	ch <- dhcpPoolSizeDesc
+	ch <- dhcpLeaseTimeDesc
+	ch <- dhcpLeasesDesc
+	ch <- dhcpLeaseRemainingDesc
+
+	// RuleSet
+	ch <- portForwardRuleDesc
+	ch <- dmzEnabledDesc
+	ch <- firewallRuleDesc
+	ch <- configRulesHashDesc
+
+	// WirelessStatus
+	ch <- wifiRadioInfoDesc
+	ch <- wifiRadioEnabledDesc
+	ch <- wifiSsidEnabledDesc
+	ch <- wifiRadioChannelDesc
+	ch <- wifiRadioBandwidthDesc
+
+	// WirelessClients
+	ch <- wifiClientsDesc
+	ch <- wifiClientRssiDesc
+	ch <- wifiClientPhyRateDesc
+
+	// EventLog
+	ch <- eventLogEntriesDesc
+
+	// DownstreamInfo
+	ch <- downstreamPowerDesc
+	ch <- downstreamSnrDesc
+	ch <- downstreamFrequencyDesc
+
+	// UpstreamInfo
+	ch <- upstreamPowerDesc
+	ch <- upstreamFrequencyDesc
+	ch <- upstreamBandwidthDesc
+
+	// Channel health
+	ch <- channelHealthDesc
+	ch <- lineHealthScoreDesc
+
+	// Extra
+	for _, e := range c.Extra {
+		for _, m := range e.Metrics {
+			ch <- m.desc
+		}
+	}
 }
 func (c *Collector) Collect(ch chan<- prom.Metric) {
-	defer measureTime(ch, "all")()
+	defer c.measureTime(ch, "all")()
 
-	loginFinished := measureTime(ch, "login")
+	loginFinished := c.measureTime(ch, "login")
 	session, err := c.Router.Login()
+	if err == ErrorTokenBusy {
+		// another scrape holds the session, which says nothing about a lockout
+		log.Info("Login: ", err)
+		ch <- prom.MustNewConstMetric(loginBackoffDesc, prom.GaugeValue, 0)
+		ch <- prom.MustNewConstMetric(loginSuccessDesc, prom.GaugeValue, 0)
+		return
+	}
+	c.Status.Set(SectionLogin, err == nil, err)
+	backoff := 0.0
+	if err == ErrorBackingOff {
+		backoff = 1
+	}
+	ch <- prom.MustNewConstMetric(loginBackoffDesc, prom.GaugeValue, backoff)
 	if err != nil {
 		ch <- prom.MustNewConstMetric(loginSuccessDesc, prom.GaugeValue, 0)
 		return
@@ -110,7 +326,7 @@ func (c *Collector) Collect(ch chan<- prom.Metric) {
 	loginFinished()
 
 	var wg sync.WaitGroup
-	wg.Add(6)
+	wg.Add(14)
 
 	// these could be run in parallel, but the webserver seems to be serial
 	// so that only screws up our section timing metrics
@@ -118,37 +334,79 @@ func (c *Collector) Collect(ch chan<- prom.Metric) {
 	c.CollectCMInit(&wg, session, ch)
 	c.CollectCMDocisWAN(&wg, session, ch)
 	c.CollectConnectInfo(&wg, session, ch)
-	c.CollectDonwstreamInfo(&wg, session, ch)
-	c.CollectUpstreamInfo(&wg, session, ch)
+	line := &lineHealth{complete: true}
+	c.CollectDonwstreamInfo(&wg, session, ch, line)
+	c.CollectUpstreamInfo(&wg, session, ch, line)
+	c.CollectMtaStatus(&wg, session, ch)
+	c.CollectMtaLines(&wg, session, ch)
+	c.CollectDhcp(&wg, session, ch)
+	c.CollectRuleSet(&wg, session, ch)
+	c.CollectWirelessStatus(&wg, session, ch)
+	c.CollectWirelessClients(&wg, session, ch)
+	c.CollectEventLog(&wg, session, ch)
+	c.CollectExtra(&wg, session, ch)
 
 	wg.Wait()
+	c.collectLineHealth(line, ch)
 	log.Debug("Collect() done.")
 }
 
+// Refresh runs a full collection and discards the metrics, which updates Status.
+func (c *Collector) Refresh() {
+	ch := make(chan prom.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	c.Collect(ch)
+	close(ch)
+	<-done
+}
+
 func (c *Collector) CollectInfo(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
-	defer measureTime(ch, "Info")()
+	defer c.measureTime(ch, "Info")()
 	defer wg.Done()
 
 	info, err := session.Info()
+	c.Status.Set(SectionInfo, info, err)
 	if err != nil {
 		// todo count errors
 		log.Info("Info: ", err)
 		return
 	}
-	ch <- prom.MustNewConstMetric(systemUptimeDesc, prom.CounterValue, parseDuration(info.SystemUptime))
-	ch <- prom.MustNewConstMetric(versionDesc, prom.GaugeValue, 1, info.HwVersion, info.SwVersion, info.SerialNumber)
-	ch <- prom.MustNewConstMetric(addressDesc, prom.GaugeValue, 1, info.WanIp, info.LanIp, info.RfMac)
-	ch <- prom.MustNewConstMetric(trafficDesc, prom.CounterValue, parsePkt(info.LRecPkt), "lan", "recv")
-	ch <- prom.MustNewConstMetric(trafficDesc, prom.CounterValue, parsePkt(info.LSendPkt), "lan", "send")
-	ch <- prom.MustNewConstMetric(trafficDesc, prom.CounterValue, parsePkt(info.WRecPkt), "wan", "recv")
-	ch <- prom.MustNewConstMetric(trafficDesc, prom.CounterValue, parsePkt(info.WSendPkt), "wan", "send")
+	ch <- prom.MustNewConstMetric(systemUptimeDesc, prom.CounterValue, info.Uptime())
+	ch <- prom.MustNewConstMetric(versionDesc, prom.GaugeValue, 1, info.HwVersion, info.SwVersion,
+		c.Redactor.Redact(FieldSerial, info.SerialNumber))
+	ch <- prom.MustNewConstMetric(addressDesc, prom.GaugeValue, 1,
+		c.Redactor.Redact(FieldWanIp, info.WanIp),
+		c.Redactor.Redact(FieldLanIp, info.LanIp),
+		c.Redactor.Redact(FieldRfMac, info.RfMac))
+	for _, iface := range []string{"lan", "wan"} {
+		recv, send := info.Traffic(iface)
+		ch <- prom.MustNewConstMetric(trafficDesc, prom.CounterValue, recv, iface, "recv")
+		ch <- prom.MustNewConstMetric(trafficDesc, prom.CounterValue, send, iface, "send")
+	}
+
+	delegatedPrefix := normalizePrefix(info.DelegatedPrefix)
+	ch <- prom.MustNewConstMetric(ipv6InfoDesc, prom.GaugeValue, 1, info.AftrName,
+		c.Redactor.Redact(FieldAftrAddr, info.AftrAddr),
+		c.Redactor.Redact(FieldIpv6Prefix, delegatedPrefix),
+		c.Redactor.Redact(FieldLanIpv6, info.LanIPv6Addr))
+	ch <- prom.MustNewConstMetric(ipv6PrefixPresentDesc, prom.GaugeValue, 1-is("", delegatedPrefix))
+	if c.Prefix != nil {
+		c.Prefix.Update(delegatedPrefix)
+		c.Prefix.collect(ch)
+	}
 }
 
 func (c *Collector) CollectCMInit(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
-	defer measureTime(ch, "CMInit")()
+	defer c.measureTime(ch, "CMInit")()
 	defer wg.Done()
 
 	cmInit, err := session.CMInit()
+	c.Status.Set(SectionCMInit, cmInit, err)
 	if err != nil {
 		log.Info("CMInit: ", err)
 		return
@@ -181,62 +439,333 @@ func (c *Collector) CollectCMInit(wg *sync.WaitGroup, session *Session, ch chan<
 }
 
 func (c *Collector) CollectCMDocisWAN(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
-	defer measureTime(ch, "CMDocsisWAN")()
+	defer c.measureTime(ch, "CMDocsisWAN")()
 	defer wg.Done()
 
 	wan, err := session.CMDocsisWAN()
+	c.Status.Set(SectionCMDocsisWAN, wan, err)
 	if err != nil {
 		log.Info("CMDocsisWAN: ", err)
 		return
 	}
 	ch <- prom.MustNewConstMetric(cmDocsisAddressDesc, prom.GaugeValue,
 		is(NetworkAccessPermitted, wan.NetworkAccess),
-		wan.CmIpAddress, wan.CmNetMask, wan.CmGateway)
+		c.Redactor.Redact(FieldCmIp, wan.CmIpAddress), wan.CmNetMask,
+		c.Redactor.Redact(FieldCmGateway, wan.CmGateway))
 	ch <- prom.MustNewConstMetric(cmIpLeaseDurationDesc, prom.CounterValue,
 		parseDuration(wan.CmIpLeaseDuration))
 }
 
 func (c *Collector) CollectConnectInfo(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
-	defer measureTime(ch, "ConnectInfo")()
+	defer c.measureTime(ch, "ConnectInfo")()
 	defer wg.Done()
 
 	info, err := session.ConnectInfo()
+	c.Status.Set(SectionConnectInfo, info, err)
 	if err != nil {
 		log.Info("ConnectInfo: ", err)
 		return
 	}
+	// A MAC can appear once per address. Id is the router's row number and
+	// changes when the table is reordered, so it is not exported.
+	online := map[string]float64{}
+	var macs []string
+	seen := map[string]bool{}
+	dropped := map[string]bool{}
 	for _, device := range info {
+		rawMac := strings.ToUpper(device.MacAddr)
+		// keyed by the exported value, so dropped MACs collapse into one series
+		mac := c.Redactor.Redact(FieldDeviceMac, rawMac)
+		if _, ok := online[mac]; !ok {
+			if c.MaxLanDevices > 0 && len(macs) >= c.MaxLanDevices {
+				dropped[mac] = true
+				continue
+			}
+			macs = append(macs, mac)
+		}
+		online[mac] = math.Max(online[mac], is("active", device.Online))
+
 		connectType := string(device.ConnectType)
 		if device.ConnectType == DHCP {
 			connectType = "dhcp"
 		} else if device.ConnectType == Static {
 			connectType = "static"
 		}
-		ch <- prom.MustNewConstMetric(lanDeviceDesc, prom.GaugeValue, is("active", device.Online),
-			device.IpAddr, device.IpType, device.MacAddr, connectType, device.Interface, fmt.Sprint(device.Comnum))
+		labels := []string{
+			mac,
+			c.Redactor.Redact(FieldHostname, hostname(device.HostName)),
+			c.Redactor.Redact(FieldDeviceIp, device.IpAddr), device.IpType,
+			c.vendor(rawMac), connectType, device.Interface, fmt.Sprint(device.Comnum),
+		}
+		key := strings.Join(labels, "\x00")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ch <- prom.MustNewConstMetric(lanDeviceInfoDesc, prom.GaugeValue, 1, labels...)
 	}
+	for _, mac := range macs {
+		ch <- prom.MustNewConstMetric(lanDeviceOnlineDesc, prom.GaugeValue, online[mac], mac)
+	}
+	if len(dropped) > 0 {
+		log.Warnf("ConnectInfo: %d devices over the limit of %d not exported", len(dropped), c.MaxLanDevices)
+	}
+	ch <- prom.MustNewConstMetric(lanDevicesDesc, prom.GaugeValue, float64(len(macs)+len(dropped)))
+	ch <- prom.MustNewConstMetric(lanDevicesDroppedDesc, prom.GaugeValue, float64(len(dropped)))
 }
 
-func (c *Collector) CollectUpstreamInfo(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
-	defer measureTime(ch, "UpstreamInfo")()
+// hostname maps the router's placeholder for unnamed devices to "".
+func hostname(raw string) string {
+	if raw == "unknown" {
+		return ""
+	}
+	return raw
+}
+
+func (c *Collector) CollectUpstreamInfo(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric, line *lineHealth) {
+	defer c.measureTime(ch, "UpstreamInfo")()
 	defer wg.Done()
 
-	_, err := session.UpstreamInfo()
+	upstream, err := session.UpstreamInfo()
+	c.Status.Set(SectionUpstream, upstream, err)
 	if err != nil {
 		log.Info("UpstreamInfo: ", err)
+		line.complete = false
 		return
 	}
+	line.upstream = upstream
+	for _, channel := range upstream {
+		channelId, portId := strconv.Itoa(channel.ChannelId), strconv.Itoa(channel.PortId)
+		ch <- prom.MustNewConstMetric(upstreamPowerDesc, prom.GaugeValue, channel.SignalStrength, channelId, portId)
+		ch <- prom.MustNewConstMetric(upstreamFrequencyDesc, prom.GaugeValue, float64(channel.Frequency), channelId, portId)
+		ch <- prom.MustNewConstMetric(upstreamBandwidthDesc, prom.GaugeValue, float64(channel.Bandwidth), channelId, portId)
+		ch <- prom.MustNewConstMetric(channelHealthDesc, prom.GaugeValue,
+			float64(c.healthProfile().Upstream(channel)), "upstream", strconv.Itoa(channel.ChannelId))
+	}
 }
 
-func (c *Collector) CollectDonwstreamInfo(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
-	defer measureTime(ch, "DownstreamInfo")()
+func (c *Collector) CollectDonwstreamInfo(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric, line *lineHealth) {
+	defer c.measureTime(ch, "DownstreamInfo")()
 	defer wg.Done()
 
-	_, err := session.DownstreamInfo()
+	downstream, err := session.DownstreamInfo()
+	c.Status.Set(SectionDownstream, downstream, err)
 	if err != nil {
 		log.Info("DownstreamInfo: ", err)
+		line.complete = false
+		return
+	}
+	line.downstream = downstream
+	for _, channel := range downstream {
+		channelId, portId := strconv.Itoa(channel.ChannelId), strconv.Itoa(channel.PortId)
+		ch <- prom.MustNewConstMetric(downstreamPowerDesc, prom.GaugeValue, channel.SignalStrength, channelId, portId)
+		ch <- prom.MustNewConstMetric(downstreamSnrDesc, prom.GaugeValue, channel.Snr, channelId, portId)
+		ch <- prom.MustNewConstMetric(downstreamFrequencyDesc, prom.GaugeValue, float64(channel.Frequency), channelId, portId)
+		ch <- prom.MustNewConstMetric(channelHealthDesc, prom.GaugeValue,
+			float64(c.healthProfile().Downstream(channel)), "downstream", strconv.Itoa(channel.ChannelId))
+	}
+}
+
+func (c *Collector) CollectMtaStatus(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "MtaStatus")()
+	defer wg.Done()
+
+	mta, err := session.MtaStatus()
+	c.Status.Set(SectionMtaStatus, mta, err)
+	if err != nil {
+		log.Info("MtaStatus: ", err)
+		return
+	}
+	ch <- prom.MustNewConstMetric(mtaDhcpDesc, prom.GaugeValue,
+		is(StatusSuccess, mta.MtaDhcp))
+	ch <- prom.MustNewConstMetric(mtaSecurityDesc, prom.GaugeValue,
+		is(StatusSuccess, mta.MtaSecurity))
+	ch <- prom.MustNewConstMetric(mtaTftpDesc, prom.GaugeValue,
+		is(StatusSuccess, mta.MtaTftp))
+	ch <- prom.MustNewConstMetric(mtaProvisioningDesc, prom.GaugeValue,
+		is(StatusSuccess, mta.MtaProvisioning))
+	ch <- prom.MustNewConstMetric(mtaAddressDesc, prom.GaugeValue, 1,
+		c.Redactor.Redact(FieldMtaIp, mta.MtaIpAddress),
+		c.Redactor.Redact(FieldMtaMac, mta.MtaMac))
+}
+
+func (c *Collector) CollectMtaLines(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "MtaLines")()
+	defer wg.Done()
+
+	lines, err := session.MtaLines()
+	c.Status.Set(SectionMtaLines, lines, err)
+	if err != nil {
+		log.Info("MtaLines: ", err)
+		return
+	}
+	for _, line := range lines {
+		ch <- prom.MustNewConstMetric(mtaLineRegisteredDesc, prom.GaugeValue,
+			is(MtaLineRegistered, line.RegStatus), fmt.Sprint(line.LineNum))
+		ch <- prom.MustNewConstMetric(mtaLineOffHookDesc, prom.GaugeValue,
+			is(MtaLineOffHook, line.HookState), fmt.Sprint(line.LineNum))
+	}
+}
+
+func (c *Collector) CollectDhcp(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "Dhcp")()
+	defer wg.Done()
+
+	setting, err := session.DhcpSetting()
+	c.Status.Set(SectionDhcpSetting, setting, err)
+	if err != nil {
+		log.Info("DhcpSetting: ", err)
+	} else {
+		ch <- prom.MustNewConstMetric(dhcpEnabledDesc, prom.GaugeValue, is(DhcpOn, setting.DhcpEnable))
+		ch <- prom.MustNewConstMetric(dhcpPoolSizeDesc, prom.GaugeValue, poolSize(setting.StartIp, setting.EndIp))
+		ch <- prom.MustNewConstMetric(dhcpLeaseTimeDesc, prom.GaugeValue, float64(setting.LeaseTime))
+	}
+
+	leases, err := session.DhcpLeases()
+	c.Status.Set(SectionDhcpLeases, leases, err)
+	if err != nil {
+		log.Info("DhcpLeases: ", err)
+		return
+	}
+	ch <- prom.MustNewConstMetric(dhcpLeasesDesc, prom.GaugeValue, float64(len(leases)))
+	seen := map[string]bool{}
+	for _, lease := range leases {
+		mac := c.Redactor.Redact(FieldDeviceMac, strings.ToUpper(lease.MacAddr))
+		ip := c.Redactor.Redact(FieldDeviceIp, lease.IpAddr)
+		key := mac + "\x00" + ip
+		if seen[key] || (c.MaxLanDevices > 0 && len(seen) >= c.MaxLanDevices) {
+			continue
+		}
+		seen[key] = true
+		ch <- prom.MustNewConstMetric(dhcpLeaseRemainingDesc, prom.GaugeValue,
+			parseDuration(lease.Expires), mac, ip)
+	}
+}
+
+func (c *Collector) CollectRuleSet(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "RuleSet")()
+	defer wg.Done()
+
+	rules, err := session.RuleSet()
+	c.Status.Set(SectionRuleSet, rules, err)
+	if err != nil {
+		log.Info("RuleSet: ", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, r := range rules.PortForwards {
+		labels := []string{r.AppName, r.Protocol, portRange(r.PubPortStart, r.PubPortEnd),
+			c.Redactor.Redact(FieldDeviceIp, r.PriIp), portRange(r.PriPortStart, r.PriPortEnd),
+			c.Redactor.Redact(FieldDeviceIp, ipRange(r.RemoteIpStart, r.RemoteIpEnd))}
+		if key := strings.Join(labels, "\x00"); !seen[key] {
+			seen[key] = true
+			ch <- prom.MustNewConstMetric(portForwardRuleDesc, prom.GaugeValue, is(RuleOn, r.RuleEnable), labels...)
+		}
+	}
+	ch <- prom.MustNewConstMetric(dmzEnabledDesc, prom.GaugeValue, is(RuleOn, rules.Dmz.DmzEnable),
+		c.Redactor.Redact(FieldDeviceIp, rules.Dmz.DmzHost))
+	for _, r := range rules.Firewall {
+		labels := []string{r.RuleName, r.Direction, r.Action, r.Protocol,
+			c.Redactor.Redact(FieldDeviceIp, r.SrcIp), c.Redactor.Redact(FieldDeviceIp, r.DstIp),
+			portRange(r.DstPortStart, r.DstPortEnd)}
+		if key := strings.Join(labels, "\x00"); !seen[key] {
+			seen[key] = true
+			ch <- prom.MustNewConstMetric(firewallRuleDesc, prom.GaugeValue, is(RuleOn, r.RuleEnable), labels...)
+		}
+	}
+	ch <- prom.MustNewConstMetric(configRulesHashDesc, prom.GaugeValue, float64(rules.Hash()))
+}
+
+func (c *Collector) CollectWirelessStatus(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "WirelessStatus")()
+	defer wg.Done()
+
+	radios, err := session.WirelessStatus()
+	c.Status.Set(SectionWirelessStatus, radios, err)
+	if err != nil {
+		log.Info("WirelessStatus: ", err)
+		return
+	}
+	// guest networks show up as additional rows for the same band
+	bands := map[string]bool{}
+	for _, radio := range radios {
+		ssid := c.Redactor.Redact(FieldSsid, radio.SsidName)
+		ch <- prom.MustNewConstMetric(wifiRadioInfoDesc, prom.GaugeValue, 1,
+			radio.Band, ssid, radio.WlsMode, radio.SecurityMode)
+		ch <- prom.MustNewConstMetric(wifiSsidEnabledDesc, prom.GaugeValue,
+			is(WirelessOn, radio.SsidEnable), radio.Band, ssid)
+		if bands[radio.Band] {
+			continue
+		}
+		bands[radio.Band] = true
+		ch <- prom.MustNewConstMetric(wifiRadioEnabledDesc, prom.GaugeValue,
+			is(WirelessOn, radio.WlsEnable), radio.Band)
+		ch <- prom.MustNewConstMetric(wifiRadioChannelDesc, prom.GaugeValue,
+			float64(radio.Channel), radio.Band)
+		ch <- prom.MustNewConstMetric(wifiRadioBandwidthDesc, prom.GaugeValue,
+			parseBandwidth(radio.Bandwidth), radio.Band)
+	}
+}
+
+func (c *Collector) CollectWirelessClients(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "WirelessClients")()
+	defer wg.Done()
+
+	clients, err := session.WirelessClients()
+	c.Status.Set(SectionWirelessClients, clients, err)
+	if err != nil {
+		log.Info("WirelessClients: ", err)
+		return
+	}
+	perBand := map[string]int{}
+	seen := map[string]bool{}
+	for _, client := range clients {
+		perBand[client.Band]++
+		mac := c.Redactor.Redact(FieldDeviceMac, strings.ToUpper(client.MacAddr))
+		key := client.Band + "\x00" + mac
+		if seen[key] || (c.MaxLanDevices > 0 && len(seen) >= c.MaxLanDevices) {
+			continue
+		}
+		seen[key] = true
+		ch <- prom.MustNewConstMetric(wifiClientRssiDesc, prom.GaugeValue,
+			client.Rssi, client.Band, mac)
+		ch <- prom.MustNewConstMetric(wifiClientPhyRateDesc, prom.GaugeValue,
+			client.PhyRate*1e6, client.Band, mac)
+	}
+	for band, count := range perBand {
+		ch <- prom.MustNewConstMetric(wifiClientsDesc, prom.GaugeValue, float64(count), band)
+	}
+}
+
+func (c *Collector) CollectEventLog(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer c.measureTime(ch, "EventLog")()
+	defer wg.Done()
+
+	if c.Events == nil {
 		return
 	}
+	if entries, err := session.DocsisEventLog(); err != nil {
+		c.Status.Set(SectionDocsisEventLog, nil, err)
+		log.Info("DocsisEventLog: ", err)
+	} else {
+		c.Status.Set(SectionDocsisEventLog, entries, nil)
+		c.Events.Update("docsis", entries)
+	}
+	if entries, err := session.SystemEventLog(); err != nil {
+		c.Status.Set(SectionSystemEventLog, nil, err)
+		log.Info("SystemEventLog: ", err)
+	} else {
+		c.Status.Set(SectionSystemEventLog, entries, nil)
+		c.Events.Update("system", entries)
+	}
+	c.Events.collect(ch)
+}
+
+func (c *Collector) vendor(mac string) string {
+	if c.OUI == nil {
+		return oui.Default.Lookup(mac)
+	}
+	return c.OUI.Lookup(mac)
 }
 
 func is(expected, actual string) float64 {
@@ -285,11 +814,59 @@ func parsePkt(raw string) float64 {
 	return out * factor
 }
 
-func measureTime(ch chan<- prom.Metric, label string) func() {
+// poolSize returns the number of IPv4 addresses from start to end, inclusive.
+func poolSize(start, end string) float64 {
+	from, err := netip.ParseAddr(start)
+	if err != nil || !from.Is4() {
+		log.Warn("Invalid DHCP pool start: ", start)
+		return -1
+	}
+	to, err := netip.ParseAddr(end)
+	if err != nil || !to.Is4() {
+		log.Warn("Invalid DHCP pool end: ", end)
+		return -1
+	}
+	a, b := from.As4(), to.As4()
+	size := int64(binary.BigEndian.Uint32(b[:])) - int64(binary.BigEndian.Uint32(a[:])) + 1
+	if size < 0 {
+		return 0
+	}
+	return float64(size)
+}
+
+// parseBandwidth parses a channel bandwidth like "80MHz" or "20/40MHz" (the upper bound is used).
+func parseBandwidth(raw string) float64 {
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "MHz")
+	if i := strings.LastIndex(raw, "/"); i >= 0 {
+		raw = raw[i+1:]
+	}
+	var mhz float64
+	if _, err := fmt.Sscanf(raw, "%f", &mhz); err != nil {
+		log.Warn("Unknown bandwidth format: ", err, " ", raw)
+		return -1
+	}
+	return mhz * 1e6
+}
+
+func (c *Collector) measureTime(ch chan<- prom.Metric, label string) func() {
 	startTime := time.Now()
 
 	return func() {
 		duration := time.Since(startTime).Seconds()
 		ch <- prom.MustNewConstMetric(scrapeTimeDesc, prom.GaugeValue, duration, label)
+		if c.ScrapeDuration != nil {
+			c.ScrapeDuration.WithLabelValues(label).Observe(duration)
+		}
 	}
 }
+
+// NewScrapeDuration creates the hitron_scrape_duration_seconds histogram for
+// Collector.ScrapeDuration. Unlike hitron_scrape_time it has to outlive the
+// Collector, so register it once.
+func NewScrapeDuration() *prom.HistogramVec {
+	return prom.NewHistogramVec(prom.HistogramOpts{
+		Name:    prefix + "scrape_duration_seconds",
+		Help:    "Duration of the scrape runs per component",
+		Buckets: prom.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"component"})
+}
@@ -1,6 +1,20 @@
 package collector
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
 
 func Example_parseUptime() {
 	fmt.Println(parseDuration("05 Days,21 Hours,33 Minutes,44 Seconds"))
@@ -16,3 +30,430 @@ func Example_parsePkt_2() {
 	fmt.Printf("%.2f", parsePkt("957.24M Bytes"))
 	// Output: 1003738890.24
 }
+
+func ExampleRedactor_Redact() {
+	r, _ := ParseRedactor("*=hash,serial=drop,lan_ip=off", "secret")
+	fmt.Printf("%q\n", r.Redact(FieldSerial, "VCAP12345678"))
+	fmt.Println(r.Redact(FieldLanIp, "192.168.0.1/24"))
+	fmt.Println(len(r.Redact(FieldRfMac, "68:8F:12:34:12:34")))
+	// Output:
+	// ""
+	// 192.168.0.1/24
+	// 16
+}
+
+func ExampleCollector_lanDevices() {
+	printMetrics(&Collector{MaxLanDevices: 2}, "hitron_lan_")
+	// Output:
+	// hitron_lan_device_info{comnum="1",hostname="",interface="Ethernet",ip="192.168.0.12",ip_type="static",ip_version="IPv4",mac="DC:A6:32:12:34:56",vendor="Raspberry Pi Trading Ltd"} 1
+	// hitron_lan_device_info{comnum="1",hostname="",interface="Ethernet",ip="fe80::dea6:32ff:fe12:3456",ip_type="dhcp",ip_version="IPv6",mac="DC:A6:32:12:34:56",vendor="Raspberry Pi Trading Ltd"} 1
+	// hitron_lan_device_info{comnum="1",hostname="nas",interface="Ethernet",ip="192.168.0.20",ip_type="dhcp",ip_version="IPv4",mac="00:11:32:AB:CD:EF",vendor="Synology Incorporated"} 1
+	// hitron_lan_device_online{mac="00:11:32:AB:CD:EF"} 1
+	// hitron_lan_device_online{mac="DC:A6:32:12:34:56"} 1
+	// hitron_lan_devices 3
+	// hitron_lan_devices_dropped 1
+}
+
+func Example_parseBandwidth() {
+	fmt.Println(parseBandwidth("80MHz"), parseBandwidth("20/40MHz"))
+	// Output: 8e+07 4e+07
+}
+
+func Example_poolSize() {
+	fmt.Println(poolSize("192.168.0.10", "192.168.0.254"))
+	// Output: 245
+}
+
+func ExampleEventLog_Update() {
+	events := NewEventLog(nil, nil)
+	t3 := EventLogEntry{Time: "04/03/2021 14:16:41", Type: "82000200", Priority: "Critical",
+		Event: "No Ranging Response received - T3 time-out"}
+	sync := EventLogEntry{Time: "04/03/2021 14:20:02", Type: "84000500", Priority: "Critical",
+		Event: "SYNC Timing Synchronization failure"}
+
+	fmt.Println(len(events.Update("docsis", []EventLogEntry{t3})))
+	added := events.Update("docsis", []EventLogEntry{t3, sync})
+	fmt.Println(len(added), added[0].Level, added[0].EventId)
+	fmt.Println(len(events.Update("docsis", []EventLogEntry{sync})))
+	// Output:
+	// 0
+	// 1 critical 84000500
+	// 0
+}
+
+// printSink prints the messages of the records written to it.
+type printSink struct{}
+
+func (printSink) Write(record EventRecord) error {
+	fmt.Println(record.Message)
+	return nil
+}
+
+func ExampleEventLog_Update_redacted() {
+	redactor, _ := ParseRedactor("rf_mac=drop", "")
+	events := NewEventLog(printSink{}, redactor)
+	t3 := EventLogEntry{Time: "04/03/2021 14:16:41", Type: "82000200", Priority: "Critical",
+		Event: "No Ranging Response received - T3 time-out;CM-MAC=68:8f:12:34:12:34;CMTS-MAC=00:01:5c:12:34:56;CM-QOS=1.1;CM-VER=3.0;"}
+
+	events.Update("docsis", nil)
+	events.Update("docsis", []EventLogEntry{t3})
+	// Output:
+	// No Ranging Response received - T3 time-out;CM-MAC=;CMTS-MAC=;CM-QOS=1.1;CM-VER=3.0;
+}
+
+func ExampleRuleSet_Diff() {
+	ssh := PortForwardRule{AppName: "ssh", RuleEnable: "ON", Protocol: "TCP",
+		PubPortStart: 2222, PubPortEnd: 2222, PriIp: "192.168.0.20", PriPortStart: 22, PriPortEnd: 22}
+	baseline := &RuleSet{PortForwards: []PortForwardRule{ssh}}
+	live := &RuleSet{Dmz: DmzSetting{DmzEnable: "ON", DmzHost: "192.168.0.20"}}
+	for _, line := range live.Diff(baseline) {
+		fmt.Println(line)
+	}
+	// Output:
+	// - dmz host= enable=
+	// + dmz host=192.168.0.20 enable=ON
+	// - port forward "ssh" TCP 2222 -> 192.168.0.20:22 from any enable=ON
+}
+
+func ExampleCollector_mta() {
+	printMetrics(&Collector{}, "hitron_mta_")
+	// Output:
+	// hitron_mta_addr{ip="10.50.12.34",mac="68:8F:12:34:12:36"} 1
+	// hitron_mta_dhcp_success 1
+	// hitron_mta_line_off_hook{line="1"} 0
+	// hitron_mta_line_off_hook{line="2"} 1
+	// hitron_mta_line_registered{line="1"} 1
+	// hitron_mta_line_registered{line="2"} 0
+	// hitron_mta_provisioning_success 1
+	// hitron_mta_security_success 1
+	// hitron_mta_tftp_success 1
+}
+
+func ExamplePrefixTracker_Update() {
+	var p PrefixTracker
+	fmt.Println(p.Update("2a02:8070:1234::/56"))
+	fmt.Println(p.Update("2a02:8070:1234::/56"))
+	fmt.Println(p.Update("::"))
+	// Output:
+	// false
+	// false
+	// true
+}
+
+func ExampleStatus_Set() {
+	status := NewStatus()
+	status.Set(SectionInfo, &SysInfo{SwVersion: "4.5.10.201-CD-UPC"}, nil)
+	status.Set(SectionInfo, nil, errors.New("getting getSysInfo: 500 Internal Server Error"))
+
+	// the failed fetch keeps the last good data
+	info, _, ok := Latest[*SysInfo](status, SectionInfo)
+	fmt.Println(info.SwVersion, ok)
+	section, _ := status.Get(SectionInfo)
+	fmt.Println(section.Error, !section.ErrorTime.Before(section.Time))
+
+	// a section which never succeeded has no data and time
+	_, _, ok = Latest[*CMInit](status, SectionCMInit)
+	status.Set(SectionCMInit, nil, errors.New("getting getCMInit: 404 Not Found"))
+	section, _ = status.Get(SectionCMInit)
+	section.ErrorTime = time.Time{}
+	data, _ := json.Marshal(section)
+	fmt.Printf("%v %s\n", ok, data)
+	// Output:
+	// 4.5.10.201-CD-UPC true
+	// getting getSysInfo: 500 Internal Server Error true
+	// false {"error":"getting getCMInit: 404 Not Found"}
+}
+
+func ExampleRedactor_RedactJSON() {
+	status := NewStatus()
+	status.Set(SectionDhcpLeases, []DhcpLease{{HostName: "laptop", IpAddr: "192.168.0.21", MacAddr: "68:DB:F5:F4:40:59"}}, nil)
+	status.Set(SectionMtaStatus, &MtaStatus{MtaProvisioning: "Success", MtaIpAddress: "10.50.12.34"}, nil)
+
+	r, _ := ParseRedactor("*=drop,device_ip=off", "")
+	for _, name := range []string{SectionDhcpLeases, SectionMtaStatus} {
+		section, _ := status.Get(name)
+		data, _ := json.Marshal(section.Data)
+		fmt.Printf("%s\n", r.RedactJSON(data))
+	}
+	// Output:
+	// [{"id":0,"hostName":"","ipAddr":"192.168.0.21","macAddr":"","expires":""}]
+	// {"mtaDhcp":"","mtaSecurity":"","mtaTftp":"","mtaProvisioning":"Success","mtaIpAddress":"","mtaMac":""}
+}
+
+func ExampleRecorder_redactBody() {
+	redactor, _ := ParseRedactor("*=drop,hostname=off", "")
+	r := &Recorder{Redactor: redactor}
+	fmt.Printf("%s\n", r.redactBody([]byte(`[{"id":1,"hostName":"laptop","ipAddr":"192.168.0.21","macAddr":"68:DB:F5:F4:40:59"}]`)))
+	fmt.Printf("%s\n", r.redactBody([]byte(`[{"event":"T3 time-out;CM-MAC=68:8f:12:34:12:34;CMTS-MAC=00:01:5c:aa:bb:cc;"}]`)))
+	// Output:
+	// [{"id":1,"hostName":"laptop","ipAddr":"","macAddr":""}]
+	// [{"event":"T3 time-out;CM-MAC=;CMTS-MAC=;"}]
+}
+
+func ExampleReplayer() {
+	router := NewHitronRouter("http://192.168.0.1", "admin", "admin")
+	router.SetTransport(&Replayer{Dir: "testdata/capture"})
+	session, err := router.Login()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer session.Logout()
+	channels, err := session.DownstreamInfo()
+	fmt.Println(len(channels), channels[0].Snr, err)
+	_, err = session.UpstreamInfo()
+	fmt.Println(err)
+	// Output:
+	// 2 36.387 <nil>
+	// getting usinfo: 404 Not Found
+}
+
+func ExampleClientMetrics() {
+	metrics := NewClientMetrics(&Replayer{Dir: "testdata/capture"})
+	router := NewHitronRouter("http://192.168.0.1", "admin", "admin")
+	router.SetTransport(metrics)
+	session, err := router.Login()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	session.DownstreamInfo()
+	session.UpstreamInfo()
+	session.Logout()
+
+	registry := prom.NewRegistry()
+	registry.MustRegister(metrics)
+	families, _ := registry.Gather()
+	for _, family := range families {
+		for _, m := range family.Metric {
+			labels := ""
+			for _, label := range m.Label {
+				labels += " " + label.GetName() + "=" + label.GetValue()
+			}
+			fmt.Printf("%s%s count=%d\n", family.GetName(), labels, m.Histogram.GetSampleCount())
+		}
+	}
+	// Output:
+	// hitron_client_request_duration_seconds code=200 endpoint=data/dsinfo.asp count=1
+	// hitron_client_request_duration_seconds code=200 endpoint=goform/login count=1
+	// hitron_client_request_duration_seconds code=200 endpoint=goform/logout count=1
+	// hitron_client_request_duration_seconds code=200 endpoint=index.html count=1
+	// hitron_client_request_duration_seconds code=404 endpoint=data/usinfo.asp count=1
+	// hitron_client_response_size_bytes endpoint=data/dsinfo.asp count=1
+	// hitron_client_response_size_bytes endpoint=data/usinfo.asp count=1
+	// hitron_client_response_size_bytes endpoint=goform/login count=1
+	// hitron_client_response_size_bytes endpoint=goform/logout count=1
+	// hitron_client_response_size_bytes endpoint=index.html count=1
+}
+
+func ExampleParseExtraEndpoints() {
+	endpoints, err := ParseExtraEndpoints([]byte(`
+- endpoint: getWirelessStatus
+  metrics:
+    - name: wifi_tx_power_percent
+      value: txPower
+      labels: {band: band}
+    - name: wifi_wps_enabled
+      value: wpsEnable
+      parser: bool
+      labels: {band: band}
+- endpoint: getSysInfo
+  metrics:
+    - name: wan_received_bytes
+      type: counter
+      items: $[0]
+      value: WRecPkt
+      parser: bytes
+`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var data interface{}
+	json.Unmarshal([]byte(`[{"band":"2.4G","txPower":"100%","wpsEnable":"ON"},{"band":"5G","txPower":"75 %","wpsEnable":"OFF"}]`), &data)
+	for _, m := range endpoints[0].Metrics {
+		ch := make(chan prom.Metric, 10)
+		m.collect(data, ch)
+		close(ch)
+		for metric := range ch {
+			var out dto.Metric
+			metric.Write(&out)
+			fmt.Println(m.Name, out.Label[0].GetValue(), out.Gauge.GetValue())
+		}
+	}
+
+	_, err = ParseExtraEndpoints([]byte(`[{endpoint: x, metrics: [{name: y, value: "a[b"}]}]`))
+	fmt.Println(err)
+	_, err = ParseExtraEndpoints([]byte(`[{endpoint: x, metrics: [{name: y, value: a}]}]`))
+	fmt.Println(err)
+	// Output:
+	// wifi_tx_power_percent 2.4G 100
+	// wifi_tx_power_percent 5G 75
+	// wifi_wps_enabled 2.4G 1
+	// wifi_wps_enabled 5G 0
+	// extra endpoint x, metric 'y': value: invalid path 'a[b' at '[b'
+	// extra endpoint x, metric 'y': items '$[*]' can match several elements, which need labels
+}
+
+func ExampleHealthProfile_Score() {
+	p := &DefaultHealthProfile
+	downstream := []DownstreamInfo{
+		{ChannelId: 1, SignalStrength: 3.5, Snr: 36.4},
+		{ChannelId: 2, SignalStrength: -8.5, Snr: 36.1},
+		{ChannelId: 3, SignalStrength: 2.0, Snr: 28.9},
+	}
+	upstream := []UpstreamInfo{{ChannelId: 4, SignalStrength: 47.5}}
+	for _, ch := range downstream {
+		fmt.Println(ch.ChannelId, p.Downstream(ch))
+	}
+	fmt.Println(upstream[0].ChannelId, p.Upstream(upstream[0]))
+	fmt.Println(p.Score(downstream, upstream))
+	// Output:
+	// 1 ok
+	// 2 warn
+	// 3 critical
+	// 4 ok
+	// 62.5
+}
+
+// TestPrometheusRules keeps rules.yml in sync with the generator and makes
+// sure the rules only use metrics the collector exports.
+func TestPrometheusRules(t *testing.T) {
+	generated, err := PrometheusRules(&DefaultHealthProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../rules.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, committed) {
+		t.Error("rules.yml is outdated, run go generate")
+	}
+
+	described := describedMetrics(&Collector{})
+	for _, name := range regexp.MustCompile(`\bhitron_[a-z0-9_]+`).FindAllString(string(generated), -1) {
+		if !described[name] {
+			t.Errorf("rules.yml uses %s, which the collector doesn't export", name)
+		}
+	}
+}
+
+// describedMetrics returns the names of the metrics c describes.
+func describedMetrics(c *Collector) map[string]bool {
+	ch := make(chan *prom.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	fqName := regexp.MustCompile(`fqName: "([^"]+)"`)
+	names := map[string]bool{}
+	for desc := range ch {
+		names[fqName.FindStringSubmatch(desc.String())[1]] = true
+	}
+	return names
+}
+
+func TestLoginTokenBusy(t *testing.T) {
+	defer func(timeout time.Duration) { WaitTimeout = timeout }(WaitTimeout)
+	WaitTimeout = 10 * time.Millisecond
+	router := NewHitronRouter("http://192.168.0.1", "admin", "admin")
+	router.SetTransport(&Replayer{Dir: "testdata/capture"})
+
+	<-accessToken // a concurrent scrape holds the session
+	defer func() { accessToken <- true }()
+	if _, err := router.Login(); err != ErrorTokenBusy {
+		t.Errorf("got %v, want ErrorTokenBusy", err)
+	}
+
+	backoffUntil.Store(time.Now().Add(time.Minute).UnixNano())
+	defer backoffUntil.Store(0)
+	if _, err := router.Login(); err != ErrorBackingOff {
+		t.Errorf("got %v during a router lockout, want ErrorBackingOff", err)
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	defer func(timeout time.Duration) { WaitTimeout = timeout }(WaitTimeout)
+	WaitTimeout = 10 * time.Millisecond
+	dir := t.TempDir()
+	if err := writeRecording(filepath.Join(dir, "goform", "login"), []byte("Wrong password")); err != nil {
+		t.Fatal(err)
+	}
+	router := NewHitronRouter("http://192.168.0.1", "admin", "wrong")
+	router.SetTransport(&Replayer{Dir: dir})
+	if _, err := router.Login(); !errors.Is(err, ErrorLoginAnswer) {
+		t.Fatalf("got %v, want ErrorLoginAnswer", err)
+	}
+
+	// the failed login must give the session back
+	router.SetTransport(&Replayer{Dir: "testdata/capture"})
+	session, err := router.Login()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Logout()
+}
+
+func TestCollectRedacts(t *testing.T) {
+	redactor, err := ParseRedactor("ssid=drop,device_ip=drop,mta_ip=drop,mta_mac=drop", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewHitronRouter("http://192.168.0.1", "admin", "admin")
+	router.SetTransport(&Replayer{Dir: "testdata/capture"})
+	registry := prom.NewRegistry()
+	registry.MustRegister(&Collector{Router: router, Redactor: redactor})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaked := map[string]bool{"MyWifi": true, "any": true, "192.168.0.0/24": true, "192.168.0.20": true,
+		"10.50.12.34": true, "68:8F:12:34:12:36": true, "203.0.113.7": true}
+	found := map[string]bool{}
+	for _, family := range families {
+		found[family.GetName()] = true
+		for _, m := range family.Metric {
+			for _, label := range m.Label {
+				if leaked[label.GetValue()] {
+					t.Errorf("%s exports %s=%q", family.GetName(), label.GetName(), label.GetValue())
+				}
+			}
+		}
+	}
+	for _, name := range []string{"hitron_wifi_radio_info", "hitron_firewall_rule", "hitron_port_forward_rule", "hitron_dmz_enabled", "hitron_mta_addr"} {
+		if !found[name] {
+			t.Errorf("%s not collected", name)
+		}
+	}
+}
+
+// printMetrics collects c from the recorded router responses in
+// testdata/capture and prints the metrics starting with prefix.
+func printMetrics(c *Collector, prefix string) {
+	c.Router = NewHitronRouter("http://192.168.0.1", "admin", "admin")
+	c.Router.SetTransport(&Replayer{Dir: "testdata/capture"})
+	registry := prom.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		fmt.Println(err)
+	}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), prefix) {
+			continue
+		}
+		for _, m := range family.Metric {
+			var labels []string
+			for _, label := range m.Label {
+				labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+			}
+			name := family.GetName()
+			if len(labels) > 0 {
+				name += "{" + strings.Join(labels, ",") + "}"
+			}
+			fmt.Println(name, m.GetGauge().GetValue())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventLog tracks the router's event logs between polls, counts new entries
+// and forwards them to an optional sink.
+//
+// The router only keeps the most recent entries and renumbers them as old
+// ones rotate out, so entries are identified by their content.
+// Entries already in the log on the first poll are counted but not forwarded.
+// The MACs in forwarded messages are rewritten by Redactor.
+type EventLog struct {
+	Sink     EventSink
+	Redactor *Redactor
+
+	mutex  sync.Mutex
+	seen   map[string]map[string]int // log -> entry key -> occurrences
+	counts map[eventCountKey]float64
+}
+
+type eventCountKey struct {
+	log, level, eventId string
+}
+
+// EventRecord is a single new event log entry, as written to sinks.
+type EventRecord struct {
+	Seen       time.Time `json:"seen"`
+	Log        string    `json:"log"`
+	Level      string    `json:"level"`
+	EventId    string    `json:"event_id"`
+	RouterTime string    `json:"router_time"`
+	Message    string    `json:"message"`
+}
+
+var eventLogEntriesDesc = prom.NewDesc(
+	prefix+"event_log_entries_total", "Number of event log entries seen",
+	[]string{"log", "level", "event_id"}, nil)
+
+func NewEventLog(sink EventSink, redactor *Redactor) *EventLog {
+	return &EventLog{
+		Sink:     sink,
+		Redactor: redactor,
+		seen:     map[string]map[string]int{},
+		counts:   map[eventCountKey]float64{},
+	}
+}
+
+// Update records the current contents of the named log and returns the
+// entries which were not present on the previous poll.
+func (e *EventLog) Update(logName string, entries []EventLogEntry) []EventRecord {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	previous, initialized := e.seen[logName]
+	current := map[string]int{}
+	var added []EventRecord
+	now := time.Now()
+	for _, entry := range entries {
+		key := entry.Time + "\x00" + entry.Type + "\x00" + entry.Event
+		current[key]++
+		if current[key] <= previous[key] {
+			continue
+		}
+		record := EventRecord{
+			Seen:       now,
+			Log:        logName,
+			Level:      strings.ToLower(strings.TrimSpace(entry.Priority)),
+			EventId:    strings.TrimSpace(entry.Type),
+			RouterTime: entry.Time,
+			Message:    e.Redactor.RedactEvent(entry.Event),
+		}
+		e.counts[eventCountKey{record.Log, record.Level, record.EventId}]++
+		if initialized {
+			added = append(added, record)
+		}
+	}
+	e.seen[logName] = current
+
+	if e.Sink != nil {
+		for _, record := range added {
+			if err := e.Sink.Write(record); err != nil {
+				log.Warn("Event sink: ", err)
+			}
+		}
+	}
+	return added
+}
+
+func (e *EventLog) collect(ch chan<- prom.Metric) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for key, count := range e.counts {
+		ch <- prom.MustNewConstMetric(eventLogEntriesDesc, prom.CounterValue, count,
+			key.log, key.level, key.eventId)
+	}
+}
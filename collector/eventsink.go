@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// EventSink receives new event log entries.
+type EventSink interface {
+	Write(EventRecord) error
+}
+
+// NewEventSink creates a sink from a spec:
+//
+//	stdout                  JSON lines on stdout
+//	file:/var/log/hitron    JSON lines appended to a file
+//	syslog                  local syslog daemon
+//	syslog://host:514       remote syslog over UDP
+//	syslog+tcp://host:514   remote syslog over TCP
+//
+// An empty spec returns a nil sink.
+func NewEventSink(spec string) (EventSink, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == "stdout":
+		return &jsonSink{w: os.Stdout}, nil
+	case strings.HasPrefix(spec, "file:"):
+		f, err := os.OpenFile(strings.TrimPrefix(spec, "file:"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening event sink")
+		}
+		return &jsonSink{w: f}, nil
+	case spec == "syslog":
+		return newSyslogSink("", "")
+	case strings.HasPrefix(spec, "syslog://"), strings.HasPrefix(spec, "syslog+tcp://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing event sink")
+		}
+		network := "udp"
+		if u.Scheme == "syslog+tcp" {
+			network = "tcp"
+		}
+		return newSyslogSink(network, u.Host)
+	}
+	return nil, errors.New("unknown event sink '" + spec + "'")
+}
+
+type jsonSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *jsonSink) Write(record EventRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package collector
+
+import "github.com/pkg/errors"
+
+func newSyslogSink(network, addr string) (EventSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
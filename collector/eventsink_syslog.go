@@ -0,0 +1,41 @@
+//go:build !windows && !plan9
+
+package collector
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/pkg/errors"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(network, addr string) (EventSink, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, "hitron-exporter")
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to syslog")
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(record EventRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	switch record.Level {
+	case "emergency", "alert", "critical":
+		return s.w.Crit(string(data))
+	case "error":
+		return s.w.Err(string(data))
+	case "warning":
+		return s.w.Warning(string(data))
+	case "notice":
+		return s.w.Notice(string(data))
+	default:
+		return s.w.Info(string(data))
+	}
+}
@@ -0,0 +1,309 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// extraPrefix keeps configured metrics apart from the built-in ones.
+const extraPrefix = prefix + "extra_"
+
+// ExtraEndpoint maps fields of a /data/<Name>.asp page to metrics without a
+// hand-written struct. Its decoded JSON is kept in Status as "extra_<Name>".
+type ExtraEndpoint struct {
+	Name    string        `yaml:"endpoint"`
+	Metrics []ExtraMetric `yaml:"metrics"`
+}
+
+// ExtraMetric exports one value per item selected by Items. Value and Labels
+// are paths relative to the item, e.g. "rssi" or "stats[0].errors".
+type ExtraMetric struct {
+	Name   string            `yaml:"name"`   // exported as hitron_extra_<name>
+	Help   string            `yaml:"help"`   //
+	Type   string            `yaml:"type"`   // gauge (default) or counter
+	Items  string            `yaml:"items"`  // $[*] (default) for every element of the response, needs Labels
+	Value  string            `yaml:"value"`  //
+	Parser string            `yaml:"parser"` // number (default), duration, bytes or bool
+	True   []string          `yaml:"true"`   // values parsed as 1 by bool, see defaultTrue
+	Labels map[string]string `yaml:"labels"` // label name: path
+
+	desc       *prom.Desc
+	valueType  prom.ValueType
+	items      jsonPath
+	value      jsonPath
+	labelNames []string
+	labelPaths []jsonPath
+}
+
+// defaultTrue are the values the router uses for enabled or successful states.
+var defaultTrue = []string{"on", "enable", "enabled", "success", "permitted", "active", "registered", "yes", "true", "1"}
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	endpointRegexp   = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+)
+
+// LoadExtraEndpoints reads extra endpoint definitions from a YAML file.
+func LoadExtraEndpoints(file string) ([]ExtraEndpoint, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseExtraEndpoints(data)
+}
+
+// ParseExtraEndpoints parses and validates extra endpoint definitions.
+func ParseExtraEndpoints(data []byte) ([]ExtraEndpoint, error) {
+	var endpoints []ExtraEndpoint
+	if err := yaml.Unmarshal(data, &endpoints); err != nil {
+		return nil, errors.Wrap(err, "parsing extra endpoints")
+	}
+	names := map[string]bool{}
+	for i := range endpoints {
+		e := &endpoints[i]
+		if !endpointRegexp.MatchString(e.Name) {
+			return nil, errors.New("extra endpoints: invalid endpoint '" + e.Name + "'")
+		}
+		for j := range e.Metrics {
+			m := &e.Metrics[j]
+			if err := m.compile(); err != nil {
+				return nil, errors.Wrap(err, "extra endpoint "+e.Name+", metric '"+m.Name+"'")
+			}
+			if names[m.Name] {
+				return nil, errors.New("extra endpoints: duplicate metric '" + m.Name + "'")
+			}
+			names[m.Name] = true
+		}
+	}
+	return endpoints, nil
+}
+
+func (m *ExtraMetric) compile() error {
+	if !metricNameRegexp.MatchString(m.Name) {
+		return errors.New("invalid name")
+	}
+	switch m.Type {
+	case "", "gauge":
+		m.valueType = prom.GaugeValue
+	case "counter":
+		m.valueType = prom.CounterValue
+	default:
+		return errors.New("unknown type '" + m.Type + "'")
+	}
+	switch m.Parser {
+	case "", "number", "duration", "bytes", "bool":
+	default:
+		return errors.New("unknown parser '" + m.Parser + "'")
+	}
+	if m.Items == "" {
+		m.Items = "$[*]"
+	}
+	var err error
+	if m.items, err = parseJSONPath(m.Items); err != nil {
+		return errors.Wrap(err, "items")
+	}
+	if m.value, err = parseJSONPath(m.Value); err != nil {
+		return errors.Wrap(err, "value")
+	}
+	for name := range m.Labels {
+		if !metricNameRegexp.MatchString(name) || strings.HasPrefix(name, "__") {
+			return errors.New("invalid label name '" + name + "'")
+		}
+		m.labelNames = append(m.labelNames, name)
+	}
+	sort.Strings(m.labelNames)
+	for _, name := range m.labelNames {
+		p, err := parseJSONPath(m.Labels[name])
+		if err != nil {
+			return errors.Wrap(err, "label "+name)
+		}
+		m.labelPaths = append(m.labelPaths, p)
+	}
+	// without labels, the series of several items would collide
+	if len(m.labelNames) == 0 && m.items.multiple() {
+		return errors.New("items '" + m.Items + "' can match several elements, which need labels")
+	}
+	help := m.Help
+	if help == "" {
+		help = "Configured from " + m.Value
+	}
+	m.desc = prom.NewDesc(extraPrefix+m.Name, help, m.labelNames, nil)
+	return nil
+}
+
+// collect sends one metric per item with a parseable value.
+func (m *ExtraMetric) collect(data interface{}, ch chan<- prom.Metric) {
+	for _, item := range m.items.eval(data) {
+		values := m.value.eval(item)
+		if len(values) == 0 {
+			log.Debugf("Extra metric %s: no value at %s", m.Name, m.Value)
+			continue
+		}
+		value, err := m.parse(values[0])
+		if err != nil {
+			log.Info("Extra metric ", m.Name, ": ", err)
+			continue
+		}
+		labels := make([]string, len(m.labelPaths))
+		for i, p := range m.labelPaths {
+			if found := p.eval(item); len(found) > 0 {
+				labels[i] = jsonString(found[0])
+			}
+		}
+		ch <- prom.MustNewConstMetric(m.desc, m.valueType, value, labels...)
+	}
+}
+
+func (m *ExtraMetric) parse(value interface{}) (float64, error) {
+	raw := jsonString(value)
+	switch m.Parser {
+	case "duration":
+		if seconds := parseDuration(raw); seconds >= 0 {
+			return seconds, nil
+		}
+	case "bytes":
+		if bytes := parsePkt(raw); bytes >= 0 {
+			return bytes, nil
+		}
+	case "bool":
+		trueValues := m.True
+		if len(trueValues) == 0 {
+			trueValues = defaultTrue
+		}
+		for _, t := range trueValues {
+			if strings.EqualFold(raw, t) {
+				return 1, nil
+			}
+		}
+		return 0, nil
+	default:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+		// allow units, e.g. "-57 dBm"
+		var f float64
+		if _, err := fmt.Sscanf(strings.TrimSpace(raw), "%g", &f); err == nil {
+			return f, nil
+		}
+	}
+	return 0, errors.New("can't parse '" + raw + "' as " + m.Parser)
+}
+
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// CollectExtra fetches the configured extra endpoints.
+func (c *Collector) CollectExtra(wg *sync.WaitGroup, session *Session, ch chan<- prom.Metric) {
+	defer wg.Done()
+
+	for _, e := range c.Extra {
+		finished := c.measureTime(ch, "extra_"+e.Name)
+		var data interface{}
+		err := session.fetch(e.Name, &data)
+		c.Status.Set("extra_"+e.Name, data, err)
+		if err != nil {
+			log.Info("Extra endpoint ", e.Name, ": ", err)
+			finished()
+			continue
+		}
+		for i := range e.Metrics {
+			e.Metrics[i].collect(data, ch)
+		}
+		finished()
+	}
+}
+
+// jsonPath is a JSONPath subset: $ for the root, .key or ["key"] for object
+// members, [n] for array elements and [*] for all of them.
+type jsonPath []pathStep
+
+type pathStep struct {
+	member bool
+	key    string
+	index  int // -1 for all elements
+}
+
+var pathStepRegexp = regexp.MustCompile(`^(?:\.?([a-zA-Z_][a-zA-Z0-9_-]*)|\[(\*|\d+)\]|\["([^"]*)"\])`)
+
+func parseJSONPath(raw string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(raw), "$")
+	var p jsonPath
+	for rest != "" {
+		match := pathStepRegexp.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, errors.New("invalid path '" + raw + "' at '" + rest + "'")
+		}
+		switch {
+		case match[1] != "":
+			p = append(p, pathStep{member: true, key: match[1]})
+		case strings.HasPrefix(match[0], `["`):
+			p = append(p, pathStep{member: true, key: match[3]})
+		case match[2] == "*":
+			p = append(p, pathStep{index: -1})
+		default:
+			n, _ := strconv.Atoi(match[2])
+			p = append(p, pathStep{index: n})
+		}
+		rest = rest[len(match[0]):]
+	}
+	return p, nil
+}
+
+// multiple reports whether the path can match more than one value.
+func (p jsonPath) multiple() bool {
+	for _, step := range p {
+		if !step.member && step.index < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// eval returns every value the path matches in data.
+func (p jsonPath) eval(data interface{}) []interface{} {
+	values := []interface{}{data}
+	for _, step := range p {
+		var next []interface{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if member, ok := v[step.key]; ok && step.member {
+					next = append(next, member)
+				}
+			case []interface{}:
+				if step.member {
+					continue
+				}
+				if step.index < 0 {
+					next = append(next, v...)
+				} else if step.index < len(v) {
+					next = append(next, v[step.index])
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// Health is the classification of a value against Thresholds.
+type Health int
+
+const (
+	HealthOk Health = iota
+	HealthWarn
+	HealthCritical
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthOk:
+		return "ok"
+	case HealthWarn:
+		return "warn"
+	}
+	return "critical"
+}
+
+// Range is an inclusive range of values.
+type Range struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+func (r Range) contains(v float64) bool {
+	return v >= r.Min && v <= r.Max
+}
+
+func (r Range) String() string {
+	switch {
+	case math.IsInf(r.Max, 1):
+		return ">= " + strconv.FormatFloat(r.Min, 'f', -1, 64)
+	case math.IsInf(r.Min, -1):
+		return "<= " + strconv.FormatFloat(r.Max, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(r.Min, 'f', -1, 64) + ".." + strconv.FormatFloat(r.Max, 'f', -1, 64)
+}
+
+// Thresholds classify values inside Ok as ok, inside Warn as warn and
+// everything else as critical.
+type Thresholds struct {
+	Ok   Range `yaml:"ok"`
+	Warn Range `yaml:"warn"`
+}
+
+func (t Thresholds) Classify(v float64) Health {
+	switch {
+	case t.Ok.contains(v):
+		return HealthOk
+	case t.Warn.contains(v):
+		return HealthWarn
+	}
+	return HealthCritical
+}
+
+// HealthProfile holds the thresholds channels are rated against, usually an
+// ISP's published ranges.
+type HealthProfile struct {
+	Name            string     `yaml:"name"`
+	DownstreamPower Thresholds `yaml:"downstream_power"` // dBmV
+	DownstreamSnr   Thresholds `yaml:"downstream_snr"`   // dB
+	UpstreamPower   Thresholds `yaml:"upstream_power"`   // dBmV
+}
+
+// DefaultHealthProfile has rough DOCSIS 3.0 ranges, as published by most cable ISPs.
+var DefaultHealthProfile = HealthProfile{
+	Name: "default",
+	DownstreamPower: Thresholds{
+		Ok:   Range{-7, 7},
+		Warn: Range{-10, 10},
+	},
+	DownstreamSnr: Thresholds{
+		Ok:   Range{33, math.Inf(1)},
+		Warn: Range{30, math.Inf(1)},
+	},
+	UpstreamPower: Thresholds{
+		Ok:   Range{35, 49},
+		Warn: Range{30, 52},
+	},
+}
+
+// LoadHealthProfile reads a profile from a YAML file. Thresholds missing
+// from the file are taken from DefaultHealthProfile.
+func LoadHealthProfile(file string) (*HealthProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	profile := DefaultHealthProfile
+	profile.Name = file
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, errors.Wrap(err, "parsing health profile")
+	}
+	return &profile, nil
+}
+
+// Downstream rates a downstream channel by its worst value.
+func (p *HealthProfile) Downstream(ch DownstreamInfo) Health {
+	return worst(p.DownstreamPower.Classify(ch.SignalStrength), p.DownstreamSnr.Classify(ch.Snr))
+}
+
+func (p *HealthProfile) Upstream(ch UpstreamInfo) Health {
+	return p.UpstreamPower.Classify(ch.SignalStrength)
+}
+
+// Score rates the whole line from 0 to 100: the share of ok channels, with
+// warn channels counting half. A line without channels scores 0.
+func (p *HealthProfile) Score(downstream []DownstreamInfo, upstream []UpstreamInfo) float64 {
+	var total float64
+	for _, ch := range downstream {
+		total += channelScore(p.Downstream(ch))
+	}
+	for _, ch := range upstream {
+		total += channelScore(p.Upstream(ch))
+	}
+	if n := len(downstream) + len(upstream); n > 0 {
+		return 100 * total / float64(n)
+	}
+	return 0
+}
+
+// Summary describes the thresholds for humans.
+func (p *HealthProfile) Summary() string {
+	return fmt.Sprintf(`Thresholds of profile %s (ok / warn, critical beyond):
+  downstream power  %s dBmV / %s dBmV
+  downstream SNR    %s dB / %s dB
+  upstream power    %s dBmV / %s dBmV
+`, p.Name, p.DownstreamPower.Ok, p.DownstreamPower.Warn, p.DownstreamSnr.Ok, p.DownstreamSnr.Warn,
+		p.UpstreamPower.Ok, p.UpstreamPower.Warn)
+}
+
+func channelScore(h Health) float64 {
+	switch h {
+	case HealthOk:
+		return 1
+	case HealthWarn:
+		return 0.5
+	}
+	return 0
+}
+
+func worst(healths ...Health) Health {
+	w := HealthOk
+	for _, h := range healths {
+		if h > w {
+			w = h
+		}
+	}
+	return w
+}
+
+// lineHealth gathers the channels of one scrape for hitron_line_health_score.
+type lineHealth struct {
+	downstream []DownstreamInfo
+	upstream   []UpstreamInfo
+	// complete is false if one of the channel lists couldn't be fetched.
+	complete bool
+}
+
+func (c *Collector) healthProfile() *HealthProfile {
+	if c.Health == nil {
+		return &DefaultHealthProfile
+	}
+	return c.Health
+}
+
+func (c *Collector) collectLineHealth(line *lineHealth, ch chan<- prom.Metric) {
+	if !line.complete {
+		return
+	}
+	ch <- prom.MustNewConstMetric(lineHealthScoreDesc, prom.GaugeValue,
+		c.healthProfile().Score(line.downstream, line.upstream))
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// PrefixTracker detects changes of the delegated IPv6 prefix between polls.
+// Losing and regaining the prefix both count as a change.
+type PrefixTracker struct {
+	mutex       sync.Mutex
+	initialized bool
+	prefix      string
+	changes     float64
+	lastChange  time.Time
+}
+
+var (
+	ipv6PrefixChangesDesc = prom.NewDesc(
+		prefix+"ipv6_prefix_changes_total", "Number of times the delegated IPv6 prefix changed", nil, nil)
+	ipv6PrefixLastChangeDesc = prom.NewDesc(
+		prefix+"ipv6_prefix_last_change_timestamp_seconds", "Time the delegated IPv6 prefix last changed", nil, nil)
+)
+
+// Update records the current prefix and reports whether it changed.
+func (p *PrefixTracker) Update(delegatedPrefix string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	current := normalizePrefix(delegatedPrefix)
+	if !p.initialized {
+		p.initialized = true
+		p.prefix = current
+		return false
+	}
+	if current == p.prefix {
+		return false
+	}
+	log.Infof("Delegated IPv6 prefix changed from '%s' to '%s'", p.prefix, current)
+	p.prefix = current
+	p.changes++
+	p.lastChange = time.Now()
+	return true
+}
+
+func (p *PrefixTracker) collect(ch chan<- prom.Metric) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ch <- prom.MustNewConstMetric(ipv6PrefixChangesDesc, prom.CounterValue, p.changes)
+	if !p.lastChange.IsZero() {
+		ch <- prom.MustNewConstMetric(ipv6PrefixLastChangeDesc, prom.GaugeValue,
+			float64(p.lastChange.UnixNano())/1e9)
+	}
+}
+
+// normalizePrefix maps the router's placeholders for "no prefix" to "".
+func normalizePrefix(raw string) string {
+	raw = strings.TrimSpace(raw)
+	switch raw {
+	case "::", "::/0", "N/A":
+		return ""
+	}
+	return raw
+}
@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prometheus rule file format.
+type promRuleFile struct {
+	Groups []promRuleGroup `yaml:"groups"`
+}
+
+type promRuleGroup struct {
+	Name  string     `yaml:"name"`
+	Rules []promRule `yaml:"rules"`
+}
+
+type promRule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// provisioningMetrics are 1 if a DOCSIS provisioning step succeeded.
+var provisioningMetrics = []string{
+	"cm_hwinit_success", "cm_find_downstream_success", "cm_ranging_success", "cm_dhcp_success",
+	"cm_download_config_success", "cm_registration_success", "cm_network_access_status",
+}
+
+// PrometheusRules returns recording and alerting rules for the exported
+// metrics, with channel thresholds at the critical bounds of profile.
+func PrometheusRules(profile *HealthProfile) ([]byte, error) {
+	// alerts drop __name__, so each step gets a label to keep the series apart
+	var provisioning []string
+	for _, name := range provisioningMetrics {
+		provisioning = append(provisioning, `label_replace(`+prefix+name+` == 0, "step", "`+name+`", "", "")`)
+	}
+	snrMin := strconv.FormatFloat(profile.DownstreamSnr.Warn.Min, 'f', -1, 64)
+	upstreamMax := strconv.FormatFloat(profile.UpstreamPower.Warn.Max, 'f', -1, 64)
+
+	file := promRuleFile{Groups: []promRuleGroup{{
+		Name: "hitron.recording",
+		Rules: []promRule{
+			{Record: "hitron:downstream_snr_db:min", Expr: "min without (channel_id, port_id) (" + prefix + "downstream_snr_db)"},
+			{Record: "hitron:downstream_power_dbmv:min", Expr: "min without (channel_id, port_id) (" + prefix + "downstream_power_dbmv)"},
+			{Record: "hitron:downstream_power_dbmv:max", Expr: "max without (channel_id, port_id) (" + prefix + "downstream_power_dbmv)"},
+			{Record: "hitron:upstream_power_dbmv:max", Expr: "max without (channel_id, port_id) (" + prefix + "upstream_power_dbmv)"},
+			{Record: "hitron:traffic_bytes:rate5m", Expr: "rate(" + prefix + "traffic[5m])"},
+			{Record: "hitron:lan_devices_online:sum", Expr: "sum without (mac) (" + prefix + "lan_device_online)"},
+		},
+	}, {
+		Name: "hitron.alerts",
+		Rules: []promRule{{
+			Alert:       "HitronLoginFailing",
+			Expr:        prefix + "login_success_bool == 0",
+			For:         "10m",
+			Labels:      map[string]string{"severity": "critical"},
+			Annotations: map[string]string{"summary": "The exporter can't log in to the router"},
+		}, {
+			Alert:       "HitronLoginBackoff",
+			Expr:        prefix + "login_backoff_active == 1",
+			Labels:      map[string]string{"severity": "warning"},
+			Annotations: map[string]string{"summary": "The router locked the login after failed attempts, check the password"},
+		}, {
+			Alert:       "HitronProvisioningFailed",
+			Expr:        strings.Join(provisioning, " or "),
+			For:         "5m",
+			Labels:      map[string]string{"severity": "critical"},
+			Annotations: map[string]string{"summary": "DOCSIS provisioning step {{ $labels.step }} failed"},
+		}, {
+			Alert:  "HitronDownstreamSnrLow",
+			Expr:   prefix + "downstream_snr_db < " + snrMin,
+			For:    "15m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary": "SNR of downstream channel {{ $labels.channel_id }} is {{ $value }} dB, below " + snrMin + " dB",
+			},
+		}, {
+			Alert:  "HitronUpstreamPowerHigh",
+			Expr:   prefix + "upstream_power_dbmv > " + upstreamMax,
+			For:    "15m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary": "Power of upstream channel {{ $labels.channel_id }} is {{ $value }} dBmV, above " + upstreamMax + " dBmV",
+			},
+		}, {
+			Alert:       "HitronRebooted",
+			Expr:        "resets(" + prefix + "info_uptime[30m]) > 0",
+			Labels:      map[string]string{"severity": "info"},
+			Annotations: map[string]string{"summary": "The router rebooted"},
+		}},
+	}}}
+
+	var out bytes.Buffer
+	out.WriteString("# Generated by `hitron-exporter rules`, do not edit.\n")
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), encoder.Close()
+}
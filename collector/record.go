@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Recorder is an http.RoundTripper that saves every successful response body
+// below Dir, at the request's path, e.g. Dir/data/dsinfo.asp. Identifying
+// values are rewritten with Redactor before saving.
+type Recorder struct {
+	Dir      string
+	Redactor *Redactor
+	Next     http.RoundTripper // http.DefaultTransport if nil
+}
+
+// Replayer is an http.RoundTripper serving the responses saved by a Recorder.
+// Requests for paths without a recording get a 404.
+type Replayer struct {
+	Dir string
+}
+
+// SetTransport replaces the transport the router's HTTP client uses, e.g.
+// with a Recorder or Replayer.
+func (r *HitronRouter) SetTransport(transport http.RoundTripper) {
+	r.client.Transport = transport
+}
+
+// redactBody rewrites the identifying values in a JSON response, keeping
+// everything else byte for byte.
+func (r *Recorder) redactBody(body []byte) []byte {
+	return r.Redactor.RedactJSON(body)
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := r.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if resp.StatusCode == http.StatusOK {
+		if err := writeRecording(recordingPath(r.Dir, request), r.redactBody(body)); err != nil {
+			log.Warn("Recording response: ", err)
+		}
+	}
+	return resp, nil
+}
+
+func writeRecording(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "writing recording")
+	}
+	return os.Rename(tmp, file)
+}
+
+func (r *Replayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    request,
+	}
+	data, err := os.ReadFile(recordingPath(r.Dir, request))
+	if os.IsNotExist(err) {
+		log.Debugln("No recording for", request.URL.Path)
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Body = http.NoBody
+		return resp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.ContentLength = int64(len(data))
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// recordingPath maps a request to its file below dir. The path is cleaned,
+// so requests can't escape dir.
+func recordingPath(dir string, request *http.Request) string {
+	p := strings.TrimPrefix(path.Clean("/"+request.URL.Path), "/")
+	if p == "" {
+		p = "index.html"
+	}
+	return filepath.Join(dir, filepath.FromSlash(p))
+}
@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type RedactMode string
+
+var (
+	RedactOff  RedactMode = "off"
+	RedactHash RedactMode = "hash"
+	RedactDrop RedactMode = "drop"
+)
+
+// Identifying fields which end up in metric labels.
+const (
+	FieldSerial     = "serial"
+	FieldWanIp      = "wan_ip"
+	FieldLanIp      = "lan_ip"
+	FieldRfMac      = "rf_mac"
+	FieldCmIp       = "cm_ip"
+	FieldCmGateway  = "cm_gateway"
+	FieldDeviceMac  = "device_mac"
+	FieldDeviceIp   = "device_ip"
+	FieldHostname   = "hostname"
+	FieldAftrAddr   = "aftr_addr"
+	FieldIpv6Prefix = "ipv6_prefix"
+	FieldLanIpv6    = "lan_ipv6"
+	FieldMtaIp      = "mta_ip"
+	FieldMtaMac     = "mta_mac"
+	FieldSsid       = "ssid"
+)
+
+var RedactFields = []string{
+	FieldSerial, FieldWanIp, FieldLanIp, FieldRfMac,
+	FieldCmIp, FieldCmGateway, FieldDeviceMac, FieldDeviceIp, FieldHostname,
+	FieldAftrAddr, FieldIpv6Prefix, FieldLanIpv6, FieldMtaIp, FieldMtaMac, FieldSsid,
+}
+
+// hashLength is the number of hex digits kept from the HMAC.
+const hashLength = 16
+
+// Redactor rewrites identifying label values before they are exported.
+// A nil Redactor passes all values through unchanged.
+type Redactor struct {
+	key   []byte
+	modes map[string]RedactMode
+}
+
+// ParseRedactor parses a spec like "serial=hash,wan_ip=drop".
+// The field "*" sets the mode for all fields not listed explicitly.
+// Hashing uses HMAC-SHA256 with key, so hashed values are stable across
+// restarts as long as the key stays the same.
+func ParseRedactor(spec, key string) (*Redactor, error) {
+	r := &Redactor{key: []byte(key), modes: map[string]RedactMode{}}
+	var fallback RedactMode
+	for _, kv := range strings.Split(spec, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		split := strings.SplitN(kv, "=", 2)
+		if len(split) != 2 {
+			return nil, errors.New("redact: expected field=mode, got '" + kv + "'")
+		}
+		field, mode := strings.TrimSpace(split[0]), RedactMode(strings.TrimSpace(split[1]))
+		switch mode {
+		case RedactOff, RedactHash, RedactDrop:
+		default:
+			return nil, errors.New("redact: unknown mode '" + string(mode) + "' for " + field)
+		}
+		if field == "*" {
+			fallback = mode
+			continue
+		}
+		if !isRedactField(field) {
+			return nil, errors.New("redact: unknown field '" + field + "'")
+		}
+		r.modes[field] = mode
+	}
+	if fallback != "" {
+		for _, field := range RedactFields {
+			if _, ok := r.modes[field]; !ok {
+				r.modes[field] = fallback
+			}
+		}
+	}
+	for field, mode := range r.modes {
+		if mode == RedactHash && len(r.key) == 0 {
+			return nil, errors.New("redact: hashing " + field + " requires a key")
+		}
+	}
+	return r, nil
+}
+
+func isRedactField(field string) bool {
+	for _, f := range RedactFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns value as configured for field.
+func (r *Redactor) Redact(field, value string) string {
+	if r == nil || value == "" {
+		return value
+	}
+	switch r.modes[field] {
+	case RedactHash:
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+	case RedactDrop:
+		return ""
+	default:
+		return value
+	}
+}
+
+// jsonFields maps the router's JSON keys holding identifying values to
+// redaction fields.
+var jsonFields = map[string]string{
+	"serialNumber":    FieldSerial,
+	"wanIp":           FieldWanIp,
+	"lanIp":           FieldLanIp,
+	"rfMac":           FieldRfMac,
+	"mtaMac":          FieldMtaMac,
+	"CmIpAddress":     FieldCmIp,
+	"CmGateway":       FieldCmGateway,
+	"mtaIpAddress":    FieldMtaIp,
+	"macAddr":         FieldDeviceMac,
+	"ipAddr":          FieldDeviceIp,
+	"priIp":           FieldDeviceIp,
+	"dmzHost":         FieldDeviceIp,
+	"hostName":        FieldHostname,
+	"aftrAddr":        FieldAftrAddr,
+	"delegatedPrefix": FieldIpv6Prefix,
+	"lanIPv6Addr":     FieldLanIpv6,
+	"srcIp":           FieldDeviceIp,
+	"dstIp":           FieldDeviceIp,
+	"ssidName":        FieldSsid,
+	"ssid":            FieldSsid,
+}
+
+var (
+	jsonValue = regexp.MustCompile(`("(\w+)"\s*:\s*")((?:[^"\\]|\\.)*)"`)
+	// event log entries name the modem's and the CMTS' MAC
+	eventMac = regexp.MustCompile(`(CM(?:TS)?-MAC=)([0-9a-fA-F:]{17})`)
+)
+
+// RedactJSON rewrites the identifying values in JSON using the router's
+// field names, e.g. a response or the decoded Status, keeping everything
+// else byte for byte.
+func (r *Redactor) RedactJSON(data []byte) []byte {
+	if r == nil {
+		return data
+	}
+	return jsonValue.ReplaceAllFunc(data, func(match []byte) []byte {
+		groups := jsonValue.FindSubmatch(match)
+		key, value := string(groups[2]), string(groups[3])
+		if field, ok := jsonFields[key]; ok {
+			value = r.Redact(field, value)
+		} else if key == "event" {
+			value = r.RedactEvent(value)
+		} else {
+			return match
+		}
+		return []byte(string(groups[1]) + value + `"`)
+	})
+}
+
+// RedactEvent rewrites the MACs in an event log message.
+func (r *Redactor) RedactEvent(event string) string {
+	if r == nil {
+		return event
+	}
+	return eventMac.ReplaceAllStringFunc(event, func(mac string) string {
+		split := eventMac.FindStringSubmatch(mac)
+		return split[1] + r.Redact(FieldRfMac, split[2])
+	})
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type PortForwardRule struct {
+	Id            int    `json:"id" yaml:"-"`                                // 1
+	AppName       string `json:"appName" yaml:"name"`                        // ssh
+	RuleEnable    string `json:"ruleEnable" yaml:"enable"`                   // ON
+	Protocol      string `json:"protocol" yaml:"protocol"`                   // TCP / UDP / TCP/UDP
+	PubPortStart  int    `json:"pubPortStart,string" yaml:"public_port"`     // 2222
+	PubPortEnd    int    `json:"pubPortEnd,string" yaml:"public_port_end"`   // 2222
+	PriIp         string `json:"priIp" yaml:"private_ip"`                    // 192.168.0.20
+	PriPortStart  int    `json:"priPortStart,string" yaml:"private_port"`    // 22
+	PriPortEnd    int    `json:"priPortEnd,string" yaml:"private_port_end"`  // 22
+	RemoteIpStart string `json:"remoteIpStart" yaml:"remote_ip,omitempty"`   // 0.0.0.0 (any)
+	RemoteIpEnd   string `json:"remoteIpEnd" yaml:"remote_ip_end,omitempty"` // 0.0.0.0 (any)
+}
+
+type DmzSetting struct {
+	DmzEnable string `json:"dmzEnable" yaml:"enable"` // OFF
+	DmzHost   string `json:"dmzHost" yaml:"host"`     // 192.168.0.20
+}
+
+type FirewallRule struct {
+	Id           int    `json:"id" yaml:"-"`                           // 1
+	RuleName     string `json:"ruleName" yaml:"name"`                  // block-smb
+	RuleEnable   string `json:"ruleEnable" yaml:"enable"`              // ON
+	Direction    string `json:"direction" yaml:"direction"`            // Inbound
+	Action       string `json:"action" yaml:"action"`                  // Deny
+	Protocol     string `json:"protocol" yaml:"protocol"`              // TCP
+	SrcIp        string `json:"srcIp" yaml:"src_ip"`                   // any
+	DstIp        string `json:"dstIp" yaml:"dst_ip"`                   // 192.168.0.0/24
+	DstPortStart int    `json:"dstPortStart,string" yaml:"dst_port"`   // 445
+	DstPortEnd   int    `json:"dstPortEnd,string" yaml:"dst_port_end"` // 445
+}
+
+// RuleSet is the router's inbound configuration: port forwards, DMZ and
+// firewall rules. It is also the format of the YAML baseline.
+type RuleSet struct {
+	PortForwards []PortForwardRule `json:"portForwards" yaml:"port_forwards"`
+	Dmz          DmzSetting        `json:"dmz" yaml:"dmz"`
+	Firewall     []FirewallRule    `json:"firewall" yaml:"firewall"`
+}
+
+func (r PortForwardRule) String() string {
+	return fmt.Sprintf("port forward %q %s %s -> %s:%s from %s enable=%s",
+		r.AppName, r.Protocol, portRange(r.PubPortStart, r.PubPortEnd),
+		r.PriIp, portRange(r.PriPortStart, r.PriPortEnd),
+		ipRange(r.RemoteIpStart, r.RemoteIpEnd), r.RuleEnable)
+}
+
+func (r FirewallRule) String() string {
+	return fmt.Sprintf("firewall %q %s %s %s %s -> %s:%s enable=%s",
+		r.RuleName, r.Direction, r.Action, r.Protocol, r.SrcIp,
+		r.DstIp, portRange(r.DstPortStart, r.DstPortEnd), r.RuleEnable)
+}
+
+func (d DmzSetting) String() string {
+	return fmt.Sprintf("dmz host=%s enable=%s", d.DmzHost, d.DmzEnable)
+}
+
+func portRange(start, end int) string {
+	if end == 0 || end == start {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
+
+func ipRange(start, end string) string {
+	if start == "" || start == "0.0.0.0" {
+		return "any"
+	}
+	if end == "" || end == start {
+		return start
+	}
+	return start + "-" + end
+}
+
+// lines returns one sorted line per rule. Router-assigned ids are ignored,
+// since they change whenever a rule is deleted.
+func (rs *RuleSet) lines() []string {
+	var lines []string
+	for _, r := range rs.PortForwards {
+		lines = append(lines, r.String())
+	}
+	lines = append(lines, rs.Dmz.String())
+	for _, r := range rs.Firewall {
+		lines = append(lines, r.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Hash returns a 48-bit digest of the rule set, exact in a float64 gauge.
+func (rs *RuleSet) Hash() uint64 {
+	sum := sha256.Sum256([]byte(strings.Join(rs.lines(), "\n")))
+	return binary.BigEndian.Uint64(sum[:8]) >> 16
+}
+
+// Diff returns the rules missing from rs ("- ") and the rules not in the
+// baseline ("+ "). It returns nil if both sets are the same.
+func (rs *RuleSet) Diff(baseline *RuleSet) []string {
+	want := map[string]int{}
+	for _, line := range baseline.lines() {
+		want[line]++
+	}
+	var diff []string
+	for _, line := range rs.lines() {
+		if want[line] > 0 {
+			want[line]--
+			continue
+		}
+		diff = append(diff, "+ "+line)
+	}
+	for _, line := range baseline.lines() {
+		if want[line] > 0 {
+			want[line]--
+			diff = append(diff, "- "+line)
+		}
+	}
+	sort.SliceStable(diff, func(i, j int) bool { return diff[i][2:] < diff[j][2:] })
+	return diff
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Names of the sections kept in Status, one per router endpoint.
+const (
+	SectionLogin           = "login"
+	SectionInfo            = "info"
+	SectionCMInit          = "cm_init"
+	SectionCMDocsisWAN     = "cm_docsis_wan"
+	SectionConnectInfo     = "connect_info"
+	SectionDownstream      = "downstream"
+	SectionUpstream        = "upstream"
+	SectionMtaStatus       = "mta_status"
+	SectionMtaLines        = "mta_lines"
+	SectionDhcpSetting     = "dhcp_setting"
+	SectionDhcpLeases      = "dhcp_leases"
+	SectionRuleSet         = "rules"
+	SectionWirelessStatus  = "wireless_status"
+	SectionWirelessClients = "wireless_clients"
+	SectionDocsisEventLog  = "docsis_event_log"
+	SectionSystemEventLog  = "system_event_log"
+)
+
+// Section is the latest result of one router endpoint.
+// Data and Time are kept from the last successful fetch if a later one fails.
+type Section struct {
+	Time      time.Time
+	Data      interface{}
+	Error     string
+	ErrorTime time.Time
+}
+
+func (s Section) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Time      *time.Time  `json:"time,omitempty"`
+		Data      interface{} `json:"data,omitempty"`
+		Error     string      `json:"error,omitempty"`
+		ErrorTime *time.Time  `json:"error_time,omitempty"`
+	}{Data: s.Data, Error: s.Error}
+	if !s.Time.IsZero() {
+		out.Time = &s.Time
+	}
+	if !s.ErrorTime.IsZero() {
+		out.ErrorTime = &s.ErrorTime
+	}
+	return json.Marshal(out)
+}
+
+// Status keeps the latest decoded data of every section, so it can be served
+// without another round trip to the router. A nil Status discards all updates.
+type Status struct {
+	mutex    sync.RWMutex
+	updated  time.Time
+	sections map[string]Section
+}
+
+func NewStatus() *Status {
+	return &Status{sections: map[string]Section{}}
+}
+
+// Set records the result of fetching a section.
+func (s *Status) Set(name string, data interface{}, err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.updated = now
+	section := s.sections[name]
+	if err != nil {
+		section.Error = err.Error()
+		section.ErrorTime = now
+	} else {
+		section = Section{Time: now, Data: data}
+	}
+	s.sections[name] = section
+}
+
+// Get returns the named section.
+func (s *Status) Get(name string) (Section, bool) {
+	if s == nil {
+		return Section{}, false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	section, ok := s.sections[name]
+	return section, ok
+}
+
+// Sections returns a copy of all sections.
+func (s *Status) Sections() map[string]Section {
+	sections := map[string]Section{}
+	if s == nil {
+		return sections
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for name, section := range s.sections {
+		sections[name] = section
+	}
+	return sections
+}
+
+// Updated returns the time of the last Set.
+func (s *Status) Updated() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.updated
+}
+
+// Latest returns the data of the named section if it was fetched successfully
+// at least once.
+func Latest[T any](s *Status, name string) (T, time.Time, bool) {
+	section, _ := s.Get(name)
+	data, ok := section.Data.(T)
+	return data, section.Time, ok
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// ClientMetrics is an http.RoundTripper which records the duration, status
+// code and response size of every router request per endpoint, e.g.
+// "goform/login" or "data/dsinfo.asp". A slowing web server is often a sign
+// the router needs a reboot.
+//
+// The histograms accumulate across scrapes, so one ClientMetrics should be
+// shared by all routers and registered as a prometheus.Collector.
+type ClientMetrics struct {
+	Next http.RoundTripper // http.DefaultTransport if nil
+
+	duration *prom.HistogramVec
+	size     *prom.HistogramVec
+}
+
+func NewClientMetrics(next http.RoundTripper) *ClientMetrics {
+	return &ClientMetrics{
+		Next: next,
+		duration: prom.NewHistogramVec(prom.HistogramOpts{
+			Name:    prefix + "client_request_duration_seconds",
+			Help:    "Duration of requests to the router's web server until the response headers arrived",
+			Buckets: prom.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"endpoint", "code"}),
+		size: prom.NewHistogramVec(prom.HistogramOpts{
+			Name:    prefix + "client_response_size_bytes",
+			Help:    "Size of the router web server's response bodies",
+			Buckets: prom.ExponentialBuckets(64, 4, 8),
+		}, []string{"endpoint"}),
+	}
+}
+
+func (m *ClientMetrics) Describe(ch chan<- *prom.Desc) {
+	m.duration.Describe(ch)
+	m.size.Describe(ch)
+}
+
+func (m *ClientMetrics) Collect(ch chan<- prom.Metric) {
+	m.duration.Collect(ch)
+	m.size.Collect(ch)
+}
+
+func (m *ClientMetrics) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := m.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	endpoint := strings.TrimPrefix(request.URL.Path, "/")
+	if endpoint == "" {
+		endpoint = "index.html"
+	}
+
+	start := time.Now()
+	resp, err := next.RoundTrip(request)
+	if err != nil {
+		m.duration.WithLabelValues(endpoint, "error").Observe(time.Since(start).Seconds())
+		return nil, err
+	}
+	m.duration.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+	resp.Body = &countingBody{ReadCloser: resp.Body, observer: m.size.WithLabelValues(endpoint), n: resp.ContentLength}
+	return resp, nil
+}
+
+// countingBody observes the size of the body once it is closed: the
+// Content-Length if the body was closed unread, else the bytes read.
+type countingBody struct {
+	io.ReadCloser
+	observer prom.Observer
+	n        int64
+	read     int64
+	closed   bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		b.observer.Observe(float64(max(b.n, b.read)))
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cfstras/hitron-exporter/collector"
+	"github.com/cfstras/hitron-exporter/dashboard"
+)
+
+// commands are run instead of the server if given as the first argument.
+var commands = map[string]func() int{
+	"status":    statusCommand,
+	"dump":      dumpCommand,
+	"channels":  channelsCommand,
+	"rules":     rulesCommand,
+	"dashboard": dashboardCommand,
+}
+
+const commandUsage = `Commands:
+  status     print provisioning and signal health, exit 1 if anything is critical
+  dump       print every /data/*.asp endpoint's raw and decoded JSON
+  channels   print the downstream and upstream channels with thresholds
+  rules      print Prometheus recording and alerting rules for the exported metrics
+  dashboard  print the Grafana dashboard for the exported metrics
+`
+
+// withSession logs in, runs f and logs out again.
+func withSession(f func(session *collector.Session) error) error {
+	session, err := newRouter().Login()
+	if err != nil {
+		return err
+	}
+	defer session.Logout()
+	return f(session)
+}
+
+type channels struct {
+	downstream []collector.DownstreamInfo
+	upstream   []collector.UpstreamInfo
+}
+
+func fetchChannels(session *collector.Session) (channels, error) {
+	var c channels
+	var err error
+	if c.downstream, err = session.DownstreamInfo(); err != nil {
+		return c, err
+	}
+	c.upstream, err = session.UpstreamInfo()
+	return c, err
+}
+
+// worst returns the worst channel health.
+func (c channels) worst() collector.Health {
+	worst := collector.HealthOk
+	for _, ch := range c.downstream {
+		worst = max(worst, healthProfile.Downstream(ch))
+	}
+	for _, ch := range c.upstream {
+		worst = max(worst, healthProfile.Upstream(ch))
+	}
+	return worst
+}
+
+// statusCommand exits with 0 if healthy, 1 if a provisioning step failed or
+// a channel is outside the critical thresholds, and 2 on errors.
+func statusCommand() int {
+	var info *collector.SysInfo
+	var cmInit *collector.CMInit
+	var c channels
+	err := withSession(func(session *collector.Session) error {
+		var err error
+		if info, err = session.Info(); err != nil {
+			return err
+		}
+		if cmInit, err = session.CMInit(); err != nil {
+			return err
+		}
+		c, err = fetchChannels(session)
+		return err
+	})
+	if err != nil {
+		log.Errorln("fetching status:", err)
+		return 2
+	}
+
+	healthy := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if info.ModelName != "" {
+		fmt.Fprintf(w, "Model:\t%s\n", info.ModelName)
+	}
+	fmt.Fprintf(w, "Hardware:\t%s\n", info.HwVersion)
+	fmt.Fprintf(w, "Software:\t%s\n", info.SwVersion)
+	fmt.Fprintf(w, "Serial:\t%s\n", redactor.Redact(collector.FieldSerial, info.SerialNumber))
+	fmt.Fprintf(w, "Uptime:\t%s\n", info.SystemUptime)
+	fmt.Fprintln(w)
+	for _, row := range []provisioningRow{
+		stepRow("HW Init", cmInit.HwInit, collector.StatusSuccess),
+		stepRow("Find Downstream", cmInit.FindDownstream, collector.StatusSuccess),
+		stepRow("Ranging", cmInit.Ranging, collector.StatusSuccess),
+		stepRow("DHCP", cmInit.Dhcp, collector.StatusSuccess),
+		stepRow("Download CM Config", cmInit.DownloadCfg, collector.StatusSuccess),
+		stepRow("Registration", cmInit.Registration, collector.StatusSuccess),
+		stepRow("Network Access", cmInit.NetworkAccess, collector.NetworkAccessPermitted),
+	} {
+		fmt.Fprintf(w, "%s:\t%s\t%s\n", row.Name, row.Value, row.Class)
+		healthy = healthy && row.Class == "ok"
+	}
+	fmt.Fprintln(w)
+	worst := c.worst()
+	fmt.Fprintf(w, "Channels:\t%d downstream, %d upstream\t%s\n", len(c.downstream), len(c.upstream), worst)
+	fmt.Fprintf(w, "Line health score:\t%.0f/100\n", healthProfile.Score(c.downstream, c.upstream))
+	w.Flush()
+
+	if !healthy || worst == collector.HealthCritical {
+		return 1
+	}
+	return 0
+}
+
+func dumpCommand() int {
+	err := withSession(func(session *collector.Session) error {
+		endpoints := collector.Endpoints
+		for _, extra := range extraEndpoints {
+			endpoints = append(endpoints, collector.Endpoint{Name: extra.Name, New: func() interface{} { return new(interface{}) }})
+		}
+		for _, endpoint := range endpoints {
+			fmt.Printf("== %s raw\n", endpoint.Name)
+			data, err := session.FetchRaw(endpoint.Name)
+			if err != nil {
+				fmt.Printf("error: %v\n\n", err)
+				continue
+			}
+			fmt.Printf("%s\n", data)
+
+			fmt.Printf("== %s decoded\n", endpoint.Name)
+			decoded := endpoint.New()
+			if err := json.Unmarshal(data, decoded); err != nil {
+				fmt.Printf("error: %v\n\n", err)
+				continue
+			}
+			pretty, err := json.MarshalIndent(decoded, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n\n", pretty)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorln("dumping endpoints:", err)
+		return 2
+	}
+	return 0
+}
+
+func channelsCommand() int {
+	var c channels
+	err := withSession(func(session *collector.Session) error {
+		var err error
+		c, err = fetchChannels(session)
+		return err
+	})
+	if err != nil {
+		log.Errorln("fetching channels:", err)
+		return 2
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DOWNSTREAM\tPORT\tCHANNEL\tFREQ MHz\tMODULATION\tPOWER dBmV\t\tSNR dB")
+	for _, ch := range c.downstream {
+		fmt.Fprintf(w, "\t%d\t%d\t%.1f\t%s\t%.1f\t%s\t%.1f\t%s\n", ch.PortId, ch.ChannelId,
+			float64(ch.Frequency)/1e6, ch.Modulation, ch.SignalStrength, healthProfile.DownstreamPower.Classify(ch.SignalStrength),
+			ch.Snr, healthProfile.DownstreamSnr.Classify(ch.Snr))
+	}
+	fmt.Fprintln(w, "UPSTREAM\tPORT\tCHANNEL\tFREQ MHz\tMODE\tPOWER dBmV")
+	for _, ch := range c.upstream {
+		fmt.Fprintf(w, "\t%d\t%d\t%.1f\t%s\t%.1f\t%s\n", ch.PortId, ch.ChannelId,
+			float64(ch.Frequency)/1e6, ch.ScdmaMode, ch.SignalStrength, healthProfile.UpstreamPower.Classify(ch.SignalStrength))
+	}
+	w.Flush()
+	fmt.Print("\n" + healthProfile.Summary())
+	return 0
+}
+
+// rulesCommand prints the rules for --health-profile. rules.yml holds the
+// ones for the default profile.
+func rulesCommand() int {
+	rules, err := collector.PrometheusRules(healthProfile)
+	if err != nil {
+		log.Errorln("generating rules:", err)
+		return 2
+	}
+	os.Stdout.Write(rules)
+	return 0
+}
+
+func dashboardCommand() int {
+	data, err := dashboard.Generate()
+	if err != nil {
+		log.Errorln("generating dashboard:", err)
+		return 2
+	}
+	os.Stdout.Write(data)
+	return 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Example_statusCommand() {
+	replay()
+	fmt.Println("exit", statusCommand())
+	// Output:
+	// Hardware:  1A
+	// Software:  4.5.10.201-CD-UPC
+	// Serial:    VCAP12345678
+	// Uptime:    04 Days,22 Hours,23 Minutes,48 Seconds
+	//
+	// HW Init:             Success    ok
+	// Find Downstream:     Success    ok
+	// Ranging:             Success    ok
+	// DHCP:                Success    ok
+	// Download CM Config:  Success    ok
+	// Registration:        Success    ok
+	// Network Access:      Permitted  ok
+	//
+	// Channels:           2 downstream, 1 upstream  critical
+	// Line health score:  67/100
+	// exit 1
+}
+
+func Example_channelsCommand() {
+	replay()
+	fmt.Println("exit", channelsCommand())
+	// Output:
+	// DOWNSTREAM  PORT  CHANNEL  FREQ MHz  MODULATION  POWER dBmV        SNR dB
+	//             1     1        474.0     256QAM      3.5         ok    36.4  ok
+	//             2     2        482.0     256QAM      -8.1        warn  28.6  critical
+	// UPSTREAM    PORT  CHANNEL  FREQ MHz  MODE        POWER dBmV
+	//             1     4        51.0      ATDMA       47.5  ok
+	//
+	// Thresholds of profile default (ok / warn, critical beyond):
+	//   downstream power  -7..7 dBmV / -10..10 dBmV
+	//   downstream SNR    >= 33 dB / >= 30 dB
+	//   upstream power    35..49 dBmV / 30..52 dBmV
+	// exit 0
+}
+
+func TestDumpCommand(t *testing.T) {
+	replay()
+	out := captureStdout(t, func() {
+		if code := dumpCommand(); code != 0 {
+			t.Errorf("exit %d", code)
+		}
+	})
+	for _, want := range []string{
+		"== getSysInfo raw\n[{\"hwVersion\":\"1A\"",
+		"== getSysInfo decoded\n[\n  {\n    \"modelName\": \"\",\n    \"hwVersion\": \"1A\"",
+		"== getDhcpLease raw\nerror: getting getDhcpLease: 404 Not Found",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump lacks %q", want)
+		}
+	}
+}
+
+// captureStdout returns what f printed to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	f()
+	os.Stdout = stdout
+	w.Close()
+	return string(<-done)
+}
@@ -0,0 +1,265 @@
+// Package dashboard generates the Grafana dashboard for the exporter's
+// metrics, so panels and metric names can't drift apart.
+package dashboard
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Grafana dashboard model, limited to the fields used here.
+type dashboard struct {
+	Title         string                 `json:"title"`
+	Uid           string                 `json:"uid"`
+	Editable      bool                   `json:"editable"`
+	SchemaVersion int                    `json:"schemaVersion"`
+	Time          map[string]string      `json:"time"`
+	Refresh       string                 `json:"refresh"`
+	Tags          []string               `json:"tags"`
+	Templating    map[string][]variable  `json:"templating"`
+	Annotations   map[string]interface{} `json:"annotations"`
+	Panels        []*panel               `json:"panels"`
+}
+
+type variable struct {
+	Name       string                 `json:"name"`
+	Label      string                 `json:"label"`
+	Type       string                 `json:"type"`
+	Query      interface{}            `json:"query"`
+	Datasource *datasource            `json:"datasource,omitempty"`
+	Refresh    int                    `json:"refresh,omitempty"`
+	Multi      bool                   `json:"multi,omitempty"`
+	IncludeAll bool                   `json:"includeAll,omitempty"`
+	Current    map[string]interface{} `json:"current"`
+	Sort       int                    `json:"sort,omitempty"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	Uid  string `json:"uid"`
+}
+
+type panel struct {
+	Id          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	Datasource  *datasource            `json:"datasource,omitempty"`
+	GridPos     gridPos                `json:"gridPos"`
+	Collapsed   *bool                  `json:"collapsed,omitempty"`
+	Targets     []target               `json:"targets,omitempty"`
+	FieldConfig map[string]interface{} `json:"fieldConfig,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+	Panels      []*panel               `json:"panels,omitempty"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	RefId        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+	Format       string `json:"format,omitempty"`
+}
+
+// row groups panels under a heading.
+type row struct {
+	title  string
+	panels []*panel
+}
+
+var promDatasource = &datasource{Type: "prometheus", Uid: "${datasource}"}
+
+// m returns a selector for the metric limited to the selected routers,
+// with optional extra matchers, e.g. m("scrape_time", `component="all"`).
+func m(name string, matchers ...string) string {
+	matchers = append([]string{`job=~"$job"`, `instance=~"$instance"`}, matchers...)
+	return "hitron_" + name + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// q is a query with its legend.
+type q struct {
+	expr, legend string
+}
+
+func targets(instant bool, queries []q) []target {
+	var out []target
+	for i, query := range queries {
+		t := target{RefId: string(rune('A' + i)), Expr: query.expr, LegendFormat: query.legend, Instant: instant}
+		if instant {
+			t.Format = "table"
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// mappings maps values to texts and colors, e.g. 1 to "Success" in green.
+type mapping struct {
+	value, text, color string
+}
+
+func valueMappings(mappings []mapping) []interface{} {
+	if len(mappings) == 0 {
+		return []interface{}{}
+	}
+	options := map[string]interface{}{}
+	for i, m := range mappings {
+		options[m.value] = map[string]interface{}{"text": m.text, "color": m.color, "index": i}
+	}
+	return []interface{}{map[string]interface{}{"type": "value", "options": options}}
+}
+
+var (
+	successMapping = []mapping{{"1", "Success", "green"}, {"0", "Failed", "red"}}
+	enabledMapping = []mapping{{"1", "On", "green"}, {"0", "Off", "text"}}
+	healthMapping  = []mapping{{"0", "ok", "green"}, {"1", "warn", "yellow"}, {"2", "critical", "red"}}
+)
+
+func fieldConfig(unit string, mappings []mapping, custom map[string]interface{}) map[string]interface{} {
+	defaults := map[string]interface{}{
+		"unit":     unit,
+		"mappings": valueMappings(mappings),
+		"color":    map[string]string{"mode": "palette-classic"},
+	}
+	if len(mappings) > 0 {
+		defaults["color"] = map[string]string{"mode": "thresholds"}
+		defaults["thresholds"] = map[string]interface{}{
+			"mode":  "absolute",
+			"steps": []interface{}{map[string]interface{}{"color": "text", "value": nil}},
+		}
+	}
+	if custom != nil {
+		defaults["custom"] = custom
+	}
+	return map[string]interface{}{"defaults": defaults, "overrides": []interface{}{}}
+}
+
+// stat shows the latest values. With showNames, the legend is shown instead
+// of the value, for metrics which carry their information in labels.
+func stat(title string, w, h int, unit string, showNames bool, mappings []mapping, queries ...q) *panel {
+	textMode := "value_and_name"
+	if showNames {
+		textMode = "name"
+	}
+	return &panel{
+		Type: "stat", Title: title, GridPos: gridPos{W: w, H: h},
+		Targets:     targets(false, queries),
+		FieldConfig: fieldConfig(unit, mappings, nil),
+		Options: map[string]interface{}{
+			"colorMode":     "value",
+			"graphMode":     "none",
+			"textMode":      textMode,
+			"reduceOptions": map[string]interface{}{"calcs": []string{"lastNotNull"}, "fields": "", "values": false},
+		},
+	}
+}
+
+func timeseries(title string, w, h int, unit string, queries ...q) *panel {
+	return &panel{
+		Type: "timeseries", Title: title, GridPos: gridPos{W: w, H: h},
+		Targets:     targets(false, queries),
+		FieldConfig: fieldConfig(unit, nil, map[string]interface{}{"fillOpacity": 10, "showPoints": "never"}),
+		Options: map[string]interface{}{
+			"legend":  map[string]interface{}{"displayMode": "list", "placement": "bottom"},
+			"tooltip": map[string]interface{}{"mode": "multi"},
+		},
+	}
+}
+
+func stateTimeline(title string, w, h int, mappings []mapping, queries ...q) *panel {
+	return &panel{
+		Type: "state-timeline", Title: title, GridPos: gridPos{W: w, H: h},
+		Targets:     targets(false, queries),
+		FieldConfig: fieldConfig("none", mappings, nil),
+		Options: map[string]interface{}{
+			"showValue": "never",
+			"legend":    map[string]interface{}{"displayMode": "list", "placement": "bottom"},
+		},
+	}
+}
+
+// table shows the labels of the latest series, one query per frame.
+func table(title string, w, h int, queries ...q) *panel {
+	return &panel{
+		Type: "table", Title: title, GridPos: gridPos{W: w, H: h},
+		Targets:     targets(true, queries),
+		FieldConfig: fieldConfig("none", nil, nil),
+		Options:     map[string]interface{}{"showHeader": true},
+	}
+}
+
+// layout assigns ids and positions, filling the 24 column grid left to right.
+func layout(rows []row) []*panel {
+	var panels []*panel
+	id, y := 1, 0
+	for _, r := range rows {
+		collapsed := false
+		panels = append(panels, &panel{Id: id, Type: "row", Title: r.title, GridPos: gridPos{H: 1, W: 24, Y: y}, Collapsed: &collapsed})
+		id++
+		y++
+		x, lineHeight := 0, 0
+		for _, p := range r.panels {
+			if x+p.GridPos.W > 24 {
+				x, y, lineHeight = 0, y+lineHeight, 0
+			}
+			p.Id = id
+			p.Datasource = promDatasource
+			p.GridPos.X, p.GridPos.Y = x, y
+			panels = append(panels, p)
+			id++
+			x += p.GridPos.W
+			lineHeight = max(lineHeight, p.GridPos.H)
+		}
+		y += lineHeight
+	}
+	return panels
+}
+
+// Generate returns the dashboard as JSON.
+func Generate() ([]byte, error) {
+	d := dashboard{
+		Title:         "Hitron Router",
+		Uid:           "HRwjc1lMk",
+		Editable:      true,
+		SchemaVersion: 39,
+		Time:          map[string]string{"from": "now-6h", "to": "now"},
+		Refresh:       "1m",
+		Tags:          []string{"hitron"},
+		Annotations: map[string]interface{}{"list": []interface{}{map[string]interface{}{
+			"builtIn": 1, "datasource": map[string]string{"type": "grafana", "uid": "-- Grafana --"},
+			"enable": true, "hide": true, "iconColor": "rgba(0, 211, 255, 1)",
+			"name": "Annotations & Alerts", "type": "dashboard",
+		}}},
+		Templating: map[string][]variable{"list": {
+			{
+				Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus",
+				Current: map[string]interface{}{},
+			},
+			{
+				Name: "job", Label: "Job", Type: "query", Datasource: promDatasource,
+				Query:   map[string]string{"query": "label_values(hitron_login_success_bool, job)", "refId": "job"},
+				Refresh: 2, Multi: true, IncludeAll: true, Sort: 1,
+				Current: map[string]interface{}{"text": "All", "value": "$__all"},
+			},
+			{
+				Name: "instance", Label: "Router", Type: "query", Datasource: promDatasource,
+				Query:   map[string]string{"query": `label_values(hitron_login_success_bool{job=~"$job"}, instance)`, "refId": "instance"},
+				Refresh: 2, Multi: true, IncludeAll: true, Sort: 1,
+				Current: map[string]interface{}{"text": "All", "value": "$__all"},
+			},
+		}},
+		Panels: layout(rows()),
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
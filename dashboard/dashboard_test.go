@@ -0,0 +1,63 @@
+package dashboard
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// TestDashboard keeps dashboard.json in sync with the generator and checks
+// that every exported metric has a panel and every panel's metric exists.
+func TestDashboard(t *testing.T) {
+	generated, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../dashboard.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, committed) {
+		t.Error("dashboard.json is outdated, run go generate")
+	}
+
+	exported := map[string]bool{}
+	ch := make(chan *prom.Desc)
+	go func() {
+		(&collector.Collector{}).Describe(ch)
+		collector.NewClientMetrics(nil).Describe(ch)
+		collector.NewScrapeDuration().Describe(ch)
+		close(ch)
+	}()
+	fqName := regexp.MustCompile(`fqName: "([^"]+)"`)
+	for desc := range ch {
+		exported[fqName.FindStringSubmatch(desc.String())[1]] = true
+	}
+
+	used := map[string]bool{}
+	metric := regexp.MustCompile(`\bhitron_[a-z0-9_]+`)
+	histogramSeries := regexp.MustCompile(`_(bucket|sum|count)$`)
+	for _, p := range layout(rows()) {
+		for _, target := range p.Targets {
+			for _, name := range metric.FindAllString(target.Expr, -1) {
+				if !exported[name] {
+					name = histogramSeries.ReplaceAllString(name, "")
+				}
+				used[name] = true
+				if !exported[name] {
+					t.Errorf("panel %q uses %s, which the collector doesn't export", p.Title, name)
+				}
+			}
+		}
+	}
+	for name := range exported {
+		if !used[name] {
+			t.Errorf("%s has no panel", name)
+		}
+	}
+}
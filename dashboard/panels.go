@@ -0,0 +1,134 @@
+package dashboard
+
+// rows defines the dashboard. Every metric the collector exports must be
+// used by a panel, which dashboard_test.go checks.
+func rows() []row {
+	devicesOnline := m("lan_device_info") + " * on(job, instance, mac) group_left " + m("lan_device_online")
+	return []row{
+		{"Router", []*panel{
+			stat("Uptime", 4, 4, "s", false, nil,
+				q{m("info_uptime"), "{{instance}}"}),
+			stat("Login", 3, 4, "none", false, successMapping,
+				q{m("login_success_bool"), "{{instance}}"}),
+			stat("Login backoff", 3, 4, "none", false, []mapping{{"1", "Locked", "red"}, {"0", "No", "green"}},
+				q{m("login_backoff_active"), "{{instance}}"}),
+			stat("Line health", 3, 4, "percent", false, nil,
+				q{m("line_health_score"), "{{instance}}"}),
+			stat("Versions", 5, 4, "none", true, nil,
+				q{m("version"), "HW {{hw_version}} / SW {{sw_version}} / {{serial}}"}),
+			stat("Addresses", 6, 4, "none", true, nil,
+				q{m("address"), "WAN {{wan_ip}} / LAN {{lan_ip}} / RF {{rf_mac}}"}),
+			stat("DOCSIS provisioning", 16, 3, "none", false, successMapping,
+				q{m("cm_hwinit_success"), "HW Init"},
+				q{m("cm_find_downstream_success"), "Downstream"},
+				q{m("cm_ranging_success"), "Ranging"},
+				q{m("cm_dhcp_success"), "DHCP"},
+				q{m("cm_download_config_success"), "Config"},
+				q{m("cm_registration_success"), "Registration"},
+				q{m("cm_network_access_status"), "Network access"}),
+			stat("BPI", 8, 3, "none", true, nil,
+				q{m("cm_bpi_status"), "AUTH {{auth}}, TEK {{tek}}"}),
+			stat("Cable modem address", 8, 3, "none", true, nil,
+				q{m("cm_docsis_addr"), "{{ip}}/{{netmask}} via {{gateway}}"}),
+			stat("Cable modem DHCP lease", 4, 3, "s", false, nil,
+				q{m("cm_dhcp_lease_duration"), "{{instance}}"}),
+		}},
+		{"Channels", []*panel{
+			timeseries("Downstream power", 8, 8, "dBmV",
+				q{m("downstream_power_dbmv"), "{{instance}} ch {{channel_id}}"}),
+			timeseries("Downstream SNR", 8, 8, "dB",
+				q{m("downstream_snr_db"), "{{instance}} ch {{channel_id}}"}),
+			timeseries("Upstream power", 8, 8, "dBmV",
+				q{m("upstream_power_dbmv"), "{{instance}} ch {{channel_id}}"}),
+			stateTimeline("Channel health", 16, 8, healthMapping,
+				q{m("channel_health"), "{{instance}} {{direction}} {{channel_id}}"}),
+			table("Channel frequencies", 8, 8,
+				q{m("downstream_frequency_hertz"), ""},
+				q{m("upstream_frequency_hertz"), ""},
+				q{m("upstream_bandwidth_hertz"), ""}),
+		}},
+		{"Traffic", []*panel{
+			timeseries("Traffic", 24, 8, "Bps",
+				q{"rate(" + m("traffic") + "[$__rate_interval])", "{{instance}} {{if}} {{dir}}"}),
+		}},
+		{"LAN", []*panel{
+			timeseries("Devices online", 8, 8, "none",
+				q{"sum by (instance, ip_type) (" + devicesOnline + ")", "{{instance}} {{ip_type}}"},
+				q{m("lan_devices"), "{{instance}} known"},
+				q{m("lan_devices_dropped"), "{{instance}} not exported"}),
+			table("Devices online", 16, 8,
+				q{devicesOnline + " == 1", ""}),
+			stat("DHCP server", 8, 4, "none", false, nil,
+				q{m("dhcp_enabled"), "Enabled"},
+				q{m("dhcp_pool_size"), "Pool size"},
+				q{m("dhcp_leases"), "Leases"}),
+			stat("DHCP lease time", 4, 4, "s", false, nil,
+				q{m("dhcp_lease_time_seconds"), "{{instance}}"}),
+			table("DHCP leases", 12, 8,
+				q{m("dhcp_lease_remaining_seconds"), ""}),
+		}},
+		{"WiFi", []*panel{
+			timeseries("WiFi clients", 8, 8, "none",
+				q{m("wifi_clients"), "{{instance}} {{band}}"}),
+			timeseries("WiFi client signal", 8, 8, "dBm",
+				q{m("wifi_client_rssi_dbm"), "{{instance}} {{band}} {{mac}}"}),
+			timeseries("WiFi client PHY rate", 8, 8, "bps",
+				q{m("wifi_client_phy_rate_bps"), "{{instance}} {{band}} {{mac}}"}),
+			table("WiFi radios", 24, 6,
+				q{m("wifi_radio_info"), ""},
+				q{m("wifi_radio_enabled"), ""},
+				q{m("wifi_ssid_enabled"), ""},
+				q{m("wifi_radio_channel"), ""},
+				q{m("wifi_radio_bandwidth_hertz"), ""}),
+		}},
+		{"IPv6", []*panel{
+			stat("IPv6", 12, 4, "none", true, nil,
+				q{m("ipv6_info"), "AFTR {{aftr_name}} {{aftr_addr}} / prefix {{delegated_prefix}} / LAN {{lan_ipv6_addr}}"}),
+			stat("Delegated prefix", 4, 4, "none", false, enabledMapping,
+				q{m("ipv6_delegated_prefix_present"), "{{instance}}"}),
+			stat("Prefix changes", 4, 4, "none", false, nil,
+				q{"increase(" + m("ipv6_prefix_changes_total") + "[$__range])", "{{instance}}"}),
+			stat("Last prefix change", 4, 4, "dateTimeFromNow", false, nil,
+				q{m("ipv6_prefix_last_change_timestamp_seconds") + " * 1000", "{{instance}}"}),
+		}},
+		{"Voice", []*panel{
+			stat("MTA provisioning", 10, 4, "none", false, successMapping,
+				q{m("mta_dhcp_success"), "DHCP"},
+				q{m("mta_security_success"), "Security"},
+				q{m("mta_tftp_success"), "Config"},
+				q{m("mta_provisioning_success"), "Provisioning"}),
+			stat("MTA address", 6, 4, "none", true, nil,
+				q{m("mta_addr"), "{{ip}} / {{mac}}"}),
+			stateTimeline("Voice lines", 8, 4, nil,
+				q{m("mta_line_registered"), "{{instance}} line {{line}} registered"},
+				q{m("mta_line_off_hook"), "{{instance}} line {{line}} off hook"}),
+		}},
+		{"Configuration", []*panel{
+			table("Port forwarding", 12, 6,
+				q{m("port_forward_rule"), ""}),
+			table("Firewall", 12, 6,
+				q{m("firewall_rule"), ""}),
+			stat("DMZ", 4, 4, "none", false, enabledMapping,
+				q{m("dmz_enabled"), "{{instance}}"}),
+			stat("Rule changes", 4, 4, "none", false, nil,
+				q{"changes(" + m("config_rules_hash") + "[$__range])", "{{instance}}"}),
+		}},
+		{"Router web server", []*panel{
+			timeseries("Request duration p95", 12, 8, "s",
+				q{"histogram_quantile(0.95, sum by (instance, endpoint, le) (rate(" + m("client_request_duration_seconds_bucket") + "[$__rate_interval])))", "{{instance}} {{endpoint}}"}),
+			timeseries("Requests by status code", 6, 8, "reqps",
+				q{"sum by (instance, code) (rate(" + m("client_request_duration_seconds_count") + "[$__rate_interval]))", "{{instance}} {{code}}"}),
+			timeseries("Average response size", 6, 8, "bytes",
+				q{"rate(" + m("client_response_size_bytes_sum") + "[$__rate_interval]) / rate(" + m("client_response_size_bytes_count") + "[$__rate_interval])", "{{instance}} {{endpoint}}"}),
+		}},
+		{"Events and exporter", []*panel{
+			timeseries("Event log entries", 8, 8, "none",
+				q{"sum by (instance, log, level) (increase(" + m("event_log_entries_total") + "[$__rate_interval]))", "{{instance}} {{log}} {{level}}"}),
+			timeseries("Scrape time by section", 8, 8, "s",
+				q{m("scrape_time", `component!="all"`), "{{instance}} {{component}}"},
+				q{m("scrape_time", `component="all"`), "{{instance}} total"}),
+			timeseries("Scrape duration p95", 8, 8, "s",
+				q{"histogram_quantile(0.95, sum by (instance, component, le) (rate(" + m("scrape_duration_seconds_bucket") + "[$__rate_interval])))", "{{instance}} {{component}}"}),
+		}},
+	}
+}
@@ -0,0 +1,241 @@
+// Package history keeps a local SQLite time series of router polls, so
+// signal levels can be trended for weeks without running Prometheus.
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// table describes one series table. Keys identify a series within the table,
+// fields are the numeric values stored per poll. Fields in categorical are
+// codes rather than measurements, so downsampling keeps the last value of each
+// step instead of averaging them.
+type table struct {
+	keys        []string
+	fields      []string
+	categorical []string
+}
+
+// Tables lists the stored tables with their keys and fields.
+var Tables = map[string]table{
+	"downstream": {
+		keys:        []string{"channel_id", "port_id"},
+		fields:      []string{"frequency", "power", "snr", "modulation"},
+		categorical: []string{"modulation"},
+	},
+	"upstream": {
+		keys:   []string{"channel_id", "port_id"},
+		fields: []string{"frequency", "bandwidth", "power"},
+	},
+	"sysinfo": {
+		fields: []string{"uptime", "lan_rx_bytes", "lan_tx_bytes", "wan_rx_bytes", "wan_tx_bytes"},
+	},
+	"cminit": {
+		fields: []string{"hw_init", "find_downstream", "ranging", "dhcp", "download_config", "registration", "network_access"},
+	},
+}
+
+// Store writes polls to SQLite. Rows older than RawRetention are averaged
+// into one row per DownsampleStep; all rows older than Retention are deleted.
+type Store struct {
+	RawRetention   time.Duration
+	DownsampleStep time.Duration
+	Retention      time.Duration
+
+	db           *sql.DB
+	mutex        sync.Mutex
+	lastMaintain time.Time
+}
+
+// maintainInterval is how often downsampling and retention run.
+const maintainInterval = time.Hour
+
+// Open opens or creates the database at path.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening history database")
+	}
+	db.SetMaxOpenConns(1) // SQLite allows a single writer
+	s := &Store{
+		RawRetention:   7 * 24 * time.Hour,
+		DownsampleStep: time.Hour,
+		Retention:      90 * 24 * time.Hour,
+		db:             db,
+	}
+	for name, t := range Tables {
+		var columns []string
+		for _, k := range t.keys {
+			columns = append(columns, k+" INTEGER NOT NULL")
+		}
+		for _, f := range t.fields {
+			columns = append(columns, f+" REAL")
+		}
+		stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			ts INTEGER NOT NULL, step INTEGER NOT NULL DEFAULT 0, %s);
+			CREATE INDEX IF NOT EXISTS %s_ts ON %s (ts);`,
+			name, strings.Join(columns, ", "), name, name)
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "creating table "+name)
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores every section fetched at or after since.
+func (s *Store) Record(status *collector.Status, since time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if info, t, ok := collector.Latest[*collector.SysInfo](status, collector.SectionInfo); ok && !t.Before(since) {
+		lanRecv, lanSend := info.Traffic("lan")
+		wanRecv, wanSend := info.Traffic("wan")
+		if err := insert(tx, "sysinfo", t, nil, info.Uptime(), lanRecv, lanSend, wanRecv, wanSend); err != nil {
+			return err
+		}
+	}
+	if cmInit, t, ok := collector.Latest[*collector.CMInit](status, collector.SectionCMInit); ok && !t.Before(since) {
+		success := func(actual, expected string) float64 {
+			if actual == expected {
+				return 1
+			}
+			return 0
+		}
+		err := insert(tx, "cminit", t, nil,
+			success(cmInit.HwInit, collector.StatusSuccess),
+			success(cmInit.FindDownstream, collector.StatusSuccess),
+			success(cmInit.Ranging, collector.StatusSuccess),
+			success(cmInit.Dhcp, collector.StatusSuccess),
+			success(cmInit.DownloadCfg, collector.StatusSuccess),
+			success(cmInit.Registration, collector.StatusSuccess),
+			success(cmInit.NetworkAccess, collector.NetworkAccessPermitted))
+		if err != nil {
+			return err
+		}
+	}
+	downstream, t, ok := collector.Latest[[]collector.DownstreamInfo](status, collector.SectionDownstream)
+	if ok && !t.Before(since) {
+		for _, ch := range downstream {
+			err := insert(tx, "downstream", t, []int{ch.ChannelId, ch.PortId},
+				float64(ch.Frequency), ch.SignalStrength, ch.Snr, float64(ch.Modulation))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	upstream, t, ok := collector.Latest[[]collector.UpstreamInfo](status, collector.SectionUpstream)
+	if ok && !t.Before(since) {
+		for _, ch := range upstream {
+			err := insert(tx, "upstream", t, []int{ch.ChannelId, ch.PortId},
+				float64(ch.Frequency), float64(ch.Bandwidth), ch.SignalStrength)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if time.Since(s.lastMaintain) >= maintainInterval {
+		s.lastMaintain = time.Now()
+		if err := s.maintain(time.Now()); err != nil {
+			log.Warn("History maintenance: ", err)
+		}
+	}
+	return nil
+}
+
+func insert(tx *sql.Tx, name string, t time.Time, keys []int, values ...float64) error {
+	def := Tables[name]
+	columns := append(append([]string{"ts"}, def.keys...), def.fields...)
+	args := []interface{}{t.Unix()}
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	for _, v := range values {
+		args = append(args, v)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	_, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		name, strings.Join(columns, ", "), placeholders), args...)
+	return errors.Wrap(err, "inserting into "+name)
+}
+
+// maintain downsamples raw rows older than RawRetention and deletes rows
+// older than Retention.
+func (s *Store) maintain(now time.Time) error {
+	step := int64(s.DownsampleStep / time.Second)
+	if step <= 0 {
+		step = 3600
+	}
+	// align to whole steps, so no step is split across two runs
+	rawCutoff := now.Add(-s.RawRetention).Unix() / step * step
+	cutoff := now.Add(-s.Retention).Unix()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for name, t := range Tables {
+		args := []interface{}{step, step, step}
+		var averages []string
+		for _, f := range t.fields {
+			if !slices.Contains(t.categorical, f) {
+				averages = append(averages, "AVG("+f+")")
+				continue
+			}
+			// the last raw value of the step and series
+			last := fmt.Sprintf("(SELECT r.%s FROM %s r WHERE r.step = 0 AND r.ts / ? = %s.ts / ?", f, name, name)
+			for _, k := range t.keys {
+				last += fmt.Sprintf(" AND r.%s = %s.%s", k, name, k)
+			}
+			averages = append(averages, last+" ORDER BY r.ts DESC LIMIT 1)")
+			args = append(args, step, step)
+		}
+		args = append(args, rawCutoff, step)
+		columns := append(append([]string{}, t.keys...), t.fields...)
+		groupBy := append([]string{"ts / ?"}, t.keys...)
+		selectKeys := ""
+		if len(t.keys) > 0 {
+			selectKeys = strings.Join(t.keys, ", ") + ", "
+		}
+		stmt := fmt.Sprintf(`INSERT INTO %s (ts, step, %s)
+			SELECT ts / ? * ?, ?, %s%s FROM %s WHERE step = 0 AND ts < ? GROUP BY %s`,
+			name, strings.Join(columns, ", "), selectKeys, strings.Join(averages, ", "),
+			name, strings.Join(groupBy, ", "))
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			return errors.Wrap(err, "downsampling "+name)
+		}
+		if _, err := tx.Exec("DELETE FROM "+name+" WHERE step = 0 AND ts < ?", rawCutoff); err != nil {
+			return errors.Wrap(err, "deleting raw rows from "+name)
+		}
+		if _, err := tx.Exec("DELETE FROM "+name+" WHERE ts < ?", cutoff); err != nil {
+			return errors.Wrap(err, "applying retention to "+name)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,67 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+func TestRecordDownsampleQuery(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	status := collector.NewStatus()
+	status.Set(collector.SectionDownstream, []collector.DownstreamInfo{
+		{PortId: 1, Frequency: 474000000, SignalStrength: 3.5, Snr: 36, ChannelId: 1},
+		{PortId: 2, Frequency: 482000000, SignalStrength: 2.5, Snr: 35, ChannelId: 2},
+	}, nil)
+	if err := store.Record(status, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// two old polls within one hour, which maintenance averages into one row
+	old := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tx, _ := store.db.Begin()
+	insert(tx, "downstream", old.Add(10*time.Minute), []int{1, 1}, 474000000, 3, 34, 6)
+	insert(tx, "downstream", old.Add(20*time.Minute), []int{1, 1}, 474000000, 3, 38, 2)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	store.Retention = 10 * 365 * 24 * time.Hour
+	if err := store.maintain(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := store.Query("downstream", "snr", old, time.Now(), map[string]string{"channel_id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 2 {
+		t.Fatalf("expected one series with two points, got %+v", series)
+	}
+	if p := series[0].Points[0]; !p.Time.Equal(old) || p.Value != 36 || p.Step != 3600 {
+		t.Errorf("expected hourly average 36 at %s, got %+v", old, p)
+	}
+	if p := series[0].Points[1]; p.Value != 36 || p.Step != 0 {
+		t.Errorf("expected raw point 36, got %+v", p)
+	}
+
+	// the modulation is a code, which must be neither averaged nor compared:
+	// the hour keeps the last one, 256QAM, rather than QPSK
+	series, err = store.Query("downstream", "modulation", old, old.Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 1 || series[0].Points[0].Value != 2 {
+		t.Errorf("expected the hourly modulation 2, got %+v", series)
+	}
+
+	if _, err := store.Query("downstream", "snr; DROP TABLE x", old, time.Now(), nil); err == nil {
+		t.Error("expected unknown field to be rejected")
+	}
+}
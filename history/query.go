@@ -0,0 +1,112 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Series is one time series from a table, e.g. the SNR of one channel.
+type Series struct {
+	Labels map[string]string `json:"labels"`
+	Points []Point           `json:"points"`
+}
+
+// Point is a single value. Step is 0 for raw polls and the downsample step
+// in seconds for averaged rows.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Step  int64     `json:"step"`
+}
+
+// Query returns field from the named table between from and to, one series
+// per key combination. filter restricts keys, e.g. channel_id=3.
+func (s *Store) Query(name, field string, from, to time.Time, filter map[string]string) ([]Series, error) {
+	t, ok := Tables[name]
+	if !ok {
+		return nil, errors.New("unknown table '" + name + "'")
+	}
+	if !contains(t.fields, field) {
+		return nil, errors.New("unknown field '" + field + "' in " + name)
+	}
+
+	where := []string{"ts >= ?", "ts <= ?"}
+	args := []interface{}{from.Unix(), to.Unix()}
+	for k, v := range filter {
+		if !contains(t.keys, k) {
+			return nil, errors.New("unknown key '" + k + "' in " + name)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "filter "+k)
+		}
+		where = append(where, k+" = ?")
+		args = append(args, n)
+	}
+	columns := append(append([]string{"ts", "step"}, t.keys...), field)
+	order := append(append([]string{}, t.keys...), "ts")
+	rows, err := s.db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s",
+		strings.Join(columns, ", "), name, strings.Join(where, " AND "), strings.Join(order, ", ")), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying "+name)
+	}
+	defer rows.Close()
+
+	var out []Series
+	index := map[string]int{}
+	for rows.Next() {
+		var ts, step int64
+		keys := make([]int64, len(t.keys))
+		var value *float64
+		dest := []interface{}{&ts, &step}
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		dest = append(dest, &value)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+
+		labels := map[string]string{}
+		var id []string
+		for i, k := range t.keys {
+			labels[k] = strconv.FormatInt(keys[i], 10)
+			id = append(id, labels[k])
+		}
+		key := strings.Join(id, ",")
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, Series{Labels: labels})
+		}
+		out[i].Points = append(out[i].Points, Point{Time: time.Unix(ts, 0).UTC(), Value: *value, Step: step})
+	}
+	return out, rows.Err()
+}
+
+// Fields returns the queryable fields of a table.
+func Fields(name string) []string {
+	return Tables[name].fields
+}
+
+// Keys returns the keys of a table.
+func Keys(name string) []string {
+	return Tables[name].keys
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cfstras/hitron-exporter/history"
+)
+
+// historyStore is set if --history-db is configured.
+var historyStore *history.Store
+
+// handleHistoryRequest serves /api/v1/history/{table}?field=snr&channel_id=3&from=...&to=...
+// from and to are RFC 3339 or durations back from now, e.g. from=24h.
+// The default range is the last 24 hours. format=csv returns CSV instead of JSON.
+func handleHistoryRequest(w http.ResponseWriter, request *http.Request) {
+	table := request.PathValue("table")
+	query := request.URL.Query()
+	now := time.Now()
+	from, err := parseHistoryTime(query.Get("from"), now.Add(-24*time.Hour), now)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from: " + err.Error()})
+		return
+	}
+	to, err := parseHistoryTime(query.Get("to"), now, now)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "to: " + err.Error()})
+		return
+	}
+	filter := map[string]string{}
+	for _, key := range history.Keys(table) {
+		if v := query.Get(key); v != "" {
+			filter[key] = v
+		}
+	}
+
+	series, err := historyStore.Query(table, query.Get("field"), from, to, filter)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if query.Get("format") != "csv" {
+		writeJSON(w, http.StatusOK, series)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	keys := history.Keys(table)
+	writer.Write(append(append([]string{"time"}, keys...), query.Get("field"), "step"))
+	for _, s := range series {
+		for _, p := range s.Points {
+			row := []string{p.Time.Format(time.RFC3339)}
+			for _, k := range keys {
+				row = append(row, s.Labels[k])
+			}
+			row = append(row, strconv.FormatFloat(p.Value, 'f', -1, 64), strconv.FormatInt(p.Step, 10))
+			writer.Write(row)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Warn("Writing CSV response: ", err)
+	}
+}
+
+func parseHistoryTime(raw string, fallback, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
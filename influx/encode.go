@@ -0,0 +1,183 @@
+// Package influx converts router polls to InfluxDB line protocol and pushes
+// them to an InfluxDB v2 compatible /api/v2/write endpoint.
+package influx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// Encoder turns the sections of a Status into line protocol.
+type Encoder struct {
+	// Tags are added to every line, e.g. site=office.
+	Tags map[string]string
+	// Redactor is applied to identifying tags. May be nil.
+	Redactor *collector.Redactor
+}
+
+type point struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]interface{}
+	time        time.Time
+}
+
+// Encode returns one line per measurement for every section fetched at or
+// after since, so stale data from failed fetches is not written twice.
+func (e *Encoder) Encode(status *collector.Status, since time.Time) []string {
+	var points []point
+	add := func(measurement string, t time.Time, tags map[string]string, fields map[string]interface{}) {
+		if t.Before(since) {
+			return
+		}
+		points = append(points, point{measurement, tags, fields, t})
+	}
+
+	if login, ok := status.Get(collector.SectionLogin); ok {
+		add("hitron_login", since, nil, map[string]interface{}{"success": login.Error == ""})
+	}
+	if info, t, ok := collector.Latest[*collector.SysInfo](status, collector.SectionInfo); ok {
+		lanRecv, lanSend := info.Traffic("lan")
+		wanRecv, wanSend := info.Traffic("wan")
+		add("hitron_sysinfo", t, map[string]string{
+			"serial":     e.Redactor.Redact(collector.FieldSerial, info.SerialNumber),
+			"hw_version": info.HwVersion,
+			"sw_version": info.SwVersion,
+		}, map[string]interface{}{
+			"uptime":       info.Uptime(),
+			"lan_rx_bytes": lanRecv,
+			"lan_tx_bytes": lanSend,
+			"wan_rx_bytes": wanRecv,
+			"wan_tx_bytes": wanSend,
+			"ipv6_prefix":  info.HasDelegatedPrefix(),
+			"aftr_name":    info.AftrName,
+		})
+	}
+	if cmInit, t, ok := collector.Latest[*collector.CMInit](status, collector.SectionCMInit); ok {
+		add("hitron_provisioning", t, nil, map[string]interface{}{
+			"hw_init":         cmInit.HwInit == collector.StatusSuccess,
+			"find_downstream": cmInit.FindDownstream == collector.StatusSuccess,
+			"ranging":         cmInit.Ranging == collector.StatusSuccess,
+			"dhcp":            cmInit.Dhcp == collector.StatusSuccess,
+			"download_config": cmInit.DownloadCfg == collector.StatusSuccess,
+			"registration":    cmInit.Registration == collector.StatusSuccess,
+			"network_access":  cmInit.NetworkAccess == collector.NetworkAccessPermitted,
+			"bpi_status":      cmInit.BpiStatus,
+		})
+	}
+	if downstream, t, ok := collector.Latest[[]collector.DownstreamInfo](status, collector.SectionDownstream); ok {
+		for _, ch := range downstream {
+			add("hitron_downstream", t, map[string]string{
+				"channel_id": strconv.Itoa(ch.ChannelId),
+				"port_id":    strconv.Itoa(ch.PortId),
+			}, map[string]interface{}{
+				"frequency":  ch.Frequency,
+				"power":      ch.SignalStrength,
+				"snr":        ch.Snr,
+				"modulation": ch.Modulation.String(),
+			})
+		}
+	}
+	if upstream, t, ok := collector.Latest[[]collector.UpstreamInfo](status, collector.SectionUpstream); ok {
+		for _, ch := range upstream {
+			add("hitron_upstream", t, map[string]string{
+				"channel_id": strconv.Itoa(ch.ChannelId),
+				"port_id":    strconv.Itoa(ch.PortId),
+			}, map[string]interface{}{
+				"frequency": ch.Frequency,
+				"bandwidth": ch.Bandwidth,
+				"power":     ch.SignalStrength,
+				"mode":      ch.ScdmaMode,
+			})
+		}
+	}
+	if devices, t, ok := collector.Latest[[]collector.ConnectInfo](status, collector.SectionConnectInfo); ok {
+		online := 0
+		for _, device := range devices {
+			if device.Online == "active" {
+				online++
+			}
+		}
+		add("hitron_lan_devices", t, nil, map[string]interface{}{
+			"total":  len(devices),
+			"online": online,
+		})
+	}
+
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		lines = append(lines, e.line(p))
+	}
+	return lines
+}
+
+func (e *Encoder) line(p point) string {
+	var b strings.Builder
+	b.WriteString(escape(p.measurement, ", "))
+
+	tags := map[string]string{}
+	for k, v := range e.Tags {
+		tags[k] = v
+	}
+	for k, v := range p.tags {
+		tags[k] = v
+	}
+	for _, k := range sortedKeys(tags) {
+		if tags[k] == "" {
+			continue // empty tag values are not allowed
+		}
+		b.WriteString("," + escape(k, ",= ") + "=" + escape(tags[k], ",= "))
+	}
+
+	for i, k := range sortedKeys(p.fields) {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(escape(k, ",= ") + "=" + fieldValue(p.fields[k]))
+	}
+	b.WriteString(" " + strconv.FormatInt(p.time.UnixNano(), 10))
+	return b.String()
+}
+
+func fieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v) + "i"
+	case int64:
+		return strconv.FormatInt(v, 10) + "i"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	}
+	return fieldValue(fmt.Sprint(v))
+}
+
+func escape(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package influx
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+func ExampleEncoder_Encode() {
+	status := collector.NewStatus()
+	status.Set(collector.SectionDownstream, []collector.DownstreamInfo{
+		{PortId: 1, Frequency: 474000000, Modulation: collector.Modulation_256QAM, SignalStrength: 3.5, Snr: 36.387, ChannelId: 1},
+	}, nil)
+	e := &Encoder{Tags: map[string]string{"site": "main office"}}
+	for _, line := range e.Encode(status, time.Time{}) {
+		fmt.Println(line[:strings.LastIndex(line, " ")])
+	}
+	// Output: hitron_downstream,channel_id=1,port_id=1,site=main\ office frequency=474000000i,modulation="256QAM",power=3.5,snr=36.387
+}
+
+func TestWriterBuffersDuringOutage(t *testing.T) {
+	var mutex sync.Mutex
+	down := true
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "hitron" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("unexpected auth header %q", r.Header.Get("Authorization"))
+		}
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, strings.TrimSpace(string(body)))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w := NewWriter(server.URL, "org", "hitron", "secret")
+	w.MaxRetries = 1
+	w.RetryBackoff = time.Millisecond
+	w.BufferDir = t.TempDir()
+
+	if err := w.Write([]string{"m v=1i 1"}); err == nil {
+		t.Fatal("expected error while server is down")
+	}
+	if files := w.bufferFiles(); len(files) != 1 {
+		t.Fatalf("expected one buffered batch, got %d", len(files))
+	}
+
+	mutex.Lock()
+	down = false
+	mutex.Unlock()
+	if err := w.Write([]string{"m v=2i 2"}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(received) != "[m v=1i 1 m v=2i 2]" {
+		t.Errorf("unexpected writes %v", received)
+	}
+	if files := w.bufferFiles(); len(files) != 0 {
+		t.Errorf("expected empty buffer, got %d files", len(files))
+	}
+}
+
+func TestEncodePlaceholderPrefix(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"::/0":                "ipv6_prefix=false",
+		"N/A":                 "ipv6_prefix=false",
+		"2a02:8070:1234::/56": "ipv6_prefix=true",
+	} {
+		status := collector.NewStatus()
+		status.Set(collector.SectionInfo, &collector.SysInfo{DelegatedPrefix: prefix}, nil)
+		lines := (&Encoder{}).Encode(status, time.Time{})
+		if len(lines) != 1 || !strings.Contains(lines[0], want) {
+			t.Errorf("prefix %q: got %v, want %s", prefix, lines, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Writer sends line protocol to an InfluxDB v2 /api/v2/write endpoint.
+// Lines are sent in batches of BatchSize. Batches which can't be delivered
+// after MaxRetries are spooled to BufferDir, if set, and resent oldest first
+// once the endpoint is reachable again.
+type Writer struct {
+	URL    string // http://influxdb:8086
+	Org    string
+	Bucket string
+	Token  string
+
+	BatchSize    int
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// BufferDir holds batches which couldn't be delivered. Disabled if empty.
+	BufferDir string
+	// MaxBufferBytes limits the size of BufferDir; the oldest batches are
+	// dropped first. Zero means no limit.
+	MaxBufferBytes int64
+
+	Client *http.Client
+
+	mutex sync.Mutex
+}
+
+// errPermanent marks responses which will not succeed on retry.
+var errPermanent = errors.New("rejected by server")
+
+// NewWriter returns a Writer with default batching and retry settings.
+func NewWriter(rawUrl, org, bucket, token string) *Writer {
+	return &Writer{
+		URL:          rawUrl,
+		Org:          org,
+		Bucket:       bucket,
+		Token:        token,
+		BatchSize:    5000,
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Write delivers lines, spooling what can't be delivered to BufferDir.
+func (w *Writer) Write(lines []string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// older batches go first, so points arrive in order
+	failed := w.flushBuffer()
+	for start := 0; start < len(lines); start += w.batchSize() {
+		end := start + w.batchSize()
+		if end > len(lines) {
+			end = len(lines)
+		}
+		batch := []byte(strings.Join(lines[start:end], "\n") + "\n")
+		if failed != nil {
+			// don't wait for more retries once the endpoint is known to be down
+			w.spool(batch)
+			continue
+		}
+		if err := w.sendWithRetry(batch); err != nil {
+			failed = err
+			if !errors.Is(err, errPermanent) {
+				w.spool(batch)
+			}
+		}
+	}
+	return failed
+}
+
+func (w *Writer) batchSize() int {
+	if w.BatchSize <= 0 {
+		return 5000
+	}
+	return w.BatchSize
+}
+
+func (w *Writer) sendWithRetry(batch []byte) error {
+	var err error
+	backoff := w.RetryBackoff
+	for attempt := 0; attempt <= w.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = w.send(batch)
+		if err == nil || errors.Is(err, errPermanent) {
+			return err
+		}
+		log.Debugf("InfluxDB write attempt %d failed: %v", attempt+1, err)
+	}
+	return err
+}
+
+func (w *Writer) send(batch []byte) error {
+	query := url.Values{
+		"org":       {w.Org},
+		"bucket":    {w.Bucket},
+		"precision": {"ns"},
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		strings.TrimSuffix(w.URL, "/")+"/api/v2/write?"+query.Encode(), bytes.NewReader(batch))
+	if err != nil {
+		return errors.Wrap(errPermanent, err.Error())
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.Token)
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return errors.Wrap(errPermanent, fmt.Sprintf("%s: %s", resp.Status, body))
+}
+
+// spool stores a batch in BufferDir.
+func (w *Writer) spool(batch []byte) {
+	if w.BufferDir == "" {
+		log.Warn("InfluxDB unreachable, dropping batch")
+		return
+	}
+	if err := os.MkdirAll(w.BufferDir, 0755); err != nil {
+		log.Warn("Creating InfluxDB buffer: ", err)
+		return
+	}
+	name := filepath.Join(w.BufferDir, fmt.Sprintf("%020d.lp", time.Now().UnixNano()))
+	if err := os.WriteFile(name, batch, 0644); err != nil {
+		log.Warn("Buffering InfluxDB batch: ", err)
+		return
+	}
+	w.trimBuffer()
+}
+
+func (w *Writer) bufferFiles() []string {
+	files, _ := filepath.Glob(filepath.Join(w.BufferDir, "*.lp"))
+	sort.Strings(files)
+	return files
+}
+
+// trimBuffer removes the oldest batches until BufferDir fits MaxBufferBytes.
+func (w *Writer) trimBuffer() {
+	if w.MaxBufferBytes <= 0 {
+		return
+	}
+	files := w.bufferFiles()
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		if stat, err := os.Stat(f); err == nil {
+			sizes[i] = stat.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(files) && total > w.MaxBufferBytes; i++ {
+		log.Warn("InfluxDB buffer full, dropping ", files[i])
+		os.Remove(files[i])
+		total -= sizes[i]
+	}
+}
+
+// flushBuffer resends spooled batches, oldest first, until one fails.
+func (w *Writer) flushBuffer() error {
+	if w.BufferDir == "" {
+		return nil
+	}
+	for _, f := range w.bufferFiles() {
+		batch, err := os.ReadFile(f)
+		if err != nil {
+			log.Warn("Reading InfluxDB buffer: ", err)
+			continue
+		}
+		if err := w.send(batch); err != nil && !errors.Is(err, errPermanent) {
+			return err
+		} else if err != nil {
+			log.Warn("Dropping buffered InfluxDB batch: ", err)
+		}
+		os.Remove(f)
+	}
+	return nil
+}
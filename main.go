@@ -1,18 +1,49 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/cfstras/hitron-exporter/collector"
+	"github.com/cfstras/hitron-exporter/oui"
 )
 
+var (
+	vendors  = oui.Default
+	redactor *collector.Redactor
+	events   *collector.EventLog
+	prefix   = &collector.PrefixTracker{}
+	status   = collector.NewStatus()
+	// transport replaces the router client's transport for --record and --replay.
+	transport http.RoundTripper
+	// clientMetrics instruments all router requests.
+	clientMetrics *collector.ClientMetrics
+	// scrapeDuration observes every Collector's scrape times.
+	scrapeDuration = collector.NewScrapeDuration()
+	// selfMetrics holds the exporter's own metrics, which outlive a scrape.
+	selfMetrics = prometheus.NewRegistry()
+	// extraEndpoints are loaded from --extra-endpoints.
+	extraEndpoints []collector.ExtraEndpoint
+	// healthProfile rates channels, loaded from --health-profile.
+	healthProfile = &collector.DefaultHealthProfile
+)
+
+//go:generate sh -c "go run . rules > rules.yml"
+//go:generate sh -c "go run . dashboard > dashboard.json"
+
 func main() {
 	flags := pflag.NewFlagSet("server", pflag.ExitOnError)
 
@@ -21,45 +52,235 @@ func main() {
 	flags.StringP("pass", "p", "admin", "Login password")
 	flags.BoolP("debug", "d", false, "Enable debug mode")
 	flags.StringP("bind", "b", ":80", "HTTP Bind address for metrics")
+	flags.String("redact", "", "Redact identifying labels: comma-separated field=mode with mode off/hash/drop, field * for all")
+	flags.String("redact-key", "", "Secret key for hash redaction")
+	flags.Int("max-lan-devices", 256, "Maximum number of LAN devices to export, 0 for no limit")
+	flags.String("event-sink", "", "Forward new router event log entries: stdout, file:PATH, syslog, syslog://HOST:PORT or syslog+tcp://HOST:PORT")
+	flags.String("write-baseline", "", "Write the router's port forwarding, DMZ and firewall rules to a YAML file and exit")
+	flags.String("diff-baseline", "", "Compare the router's rules against a YAML baseline and exit non-zero on drift")
+	flags.Bool("api", true, "Serve the latest router data as JSON on /api/v1/status")
+	flags.Duration("api-max-age", 30*time.Second, "Poll the router for API requests if the latest data is older than this")
+	flags.Duration("push-interval", time.Minute, "Poll interval for push outputs")
+	flags.String("influx-url", "", "Push to this InfluxDB v2 URL, e.g. http://influxdb:8086")
+	flags.String("influx-org", "", "InfluxDB organization")
+	flags.String("influx-bucket", "hitron", "InfluxDB bucket")
+	flags.String("influx-token", "", "InfluxDB API token")
+	flags.String("influx-tags", "", "Extra tags for every point: comma-separated key=value")
+	flags.Int("influx-batch-size", 5000, "Lines per InfluxDB write request")
+	flags.String("influx-buffer-dir", "", "Directory to buffer undelivered InfluxDB batches in")
+	flags.Int64("influx-buffer-max-bytes", 64<<20, "Maximum size of the InfluxDB buffer directory")
+	flags.String("mqtt-broker", "", "Publish to this MQTT broker, e.g. tcp://mosquitto:1883 or ssl://mosquitto:8883")
+	flags.String("mqtt-user", "", "MQTT username")
+	flags.String("mqtt-pass", "", "MQTT password")
+	flags.String("mqtt-client-id", "hitron-exporter", "MQTT client id")
+	flags.String("mqtt-ca-file", "", "CA certificate to verify the MQTT broker with")
+	flags.String("mqtt-cert-file", "", "Client certificate for MQTT")
+	flags.String("mqtt-key-file", "", "Client key for MQTT")
+	flags.Bool("mqtt-insecure", false, "Don't verify the MQTT broker's certificate")
+	flags.String("mqtt-topic-prefix", "hitron", "Prefix for MQTT state topics")
+	flags.String("mqtt-discovery-prefix", "homeassistant", "Home Assistant discovery prefix, empty to disable discovery")
+	flags.String("mqtt-node-id", "hitron", "Node id for Home Assistant discovery")
+	flags.String("otlp-endpoint", "", "Export metrics over OTLP to this collector URL, e.g. http://otel-collector:4318")
+	flags.String("otlp-protocol", "http", "OTLP protocol: http or grpc")
+	flags.String("otlp-headers", "", "Extra OTLP request headers: comma-separated key=value")
+	flags.String("otlp-attributes", "", "Extra OTLP resource attributes, e.g. site=office: comma-separated key=value")
+	flags.String("remote-write-url", "", "Push metrics to this Prometheus remote_write URL")
+	flags.String("remote-write-bearer-token", "", "Bearer token for remote_write")
+	flags.String("remote-write-user", "", "Basic auth username for remote_write")
+	flags.String("remote-write-pass", "", "Basic auth password for remote_write")
+	flags.String("remote-write-labels", "", "Labels for every remote_write series, e.g. instance=site1: comma-separated key=value")
+	flags.String("remote-write-wal-dir", "", "Directory to buffer remote_write requests in during outages, memory if empty")
+	flags.Int64("remote-write-wal-max-bytes", 64<<20, "Maximum size of the remote_write buffer")
+	flags.String("history-db", "", "Record every poll to this SQLite database and serve it on /api/v1/history")
+	flags.Duration("history-raw-retention", 7*24*time.Hour, "Keep every poll for this long before averaging")
+	flags.Duration("history-downsample-step", time.Hour, "Average polls older than --history-raw-retention into steps of this size")
+	flags.Duration("history-retention", 90*24*time.Hour, "Delete history older than this")
+	flags.Bool("prometheus", true, "Serve Prometheus metrics on /metrics")
+	flags.String("oui-file", "", "IEEE oui.csv to use for MAC vendor lookup instead of the embedded one")
+	flags.String("alert-rules", "", "YAML file with alert rules and notifiers, evaluated every --push-interval")
+	flags.String("health-profile", "", "YAML file with the channel thresholds, e.g. your ISP's published ranges")
+	flags.String("extra-endpoints", "", "YAML file mapping fields of further /data/*.asp pages to metrics")
+	flags.String("record", "", "Save every router response to this directory, redacted with --redact or hashed with a random key")
+	flags.String("replay", "", "Answer router requests from a --record directory instead of contacting the router")
 
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\n%s\nFlags:\n%s", os.Args[0], commandUsage, flags.FlagUsages())
+	}
 	flags.Parse(os.Args)
+	args := flags.Args()
 	os.Args = os.Args[0:1] // clear arguments for coredns
 	viper.BindPFlags(flags)
 
 	viper.SetEnvPrefix("HIT") // will be uppercased automatically
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
 
 	if viper.GetBool("debug") {
 		log.SetLevel(log.DebugLevel)
 	}
+	if path := viper.GetString("oui-file"); path != "" {
+		db, err := oui.LoadFile(path)
+		if err != nil {
+			log.Fatalln("loading OUI database:", err)
+		}
+		vendors = db
+	}
+	if path := viper.GetString("extra-endpoints"); path != "" {
+		var err error
+		extraEndpoints, err = collector.LoadExtraEndpoints(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if path := viper.GetString("health-profile"); path != "" {
+		var err error
+		healthProfile, err = collector.LoadHealthProfile(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	redactor = setupRedactor()
+	transport = setupTransport()
+	clientMetrics = collector.NewClientMetrics(transport)
+	selfMetrics.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+		clientMetrics,
+		scrapeDuration,
+	)
+	if len(args) > 1 {
+		command, ok := commands[args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[1])
+			flags.Usage()
+			os.Exit(2)
+		}
+		os.Exit(command())
+	}
+	if path := viper.GetString("write-baseline"); path != "" {
+		writeBaseline(path)
+		return
+	}
+	if path := viper.GetString("diff-baseline"); path != "" {
+		diffBaseline(path)
+		return
+	}
+	log.Debugln("OUI database entries:", vendors.Len())
+	sink, err := collector.NewEventSink(viper.GetString("event-sink"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	events = collector.NewEventLog(sink, redactor)
+	setupPushOutputs()
+	setupAlerts()
+	startPushLoop()
+	startOTLP()
 	startServer()
 }
 
+// setupRedactor parses --redact, nil if unset.
+func setupRedactor() *collector.Redactor {
+	spec := viper.GetString("redact")
+	if spec == "" {
+		return nil
+	}
+	r, err := collector.ParseRedactor(spec, viper.GetString("redact-key"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return r
+}
+
+// setupTransport returns the transport for --record or --replay, nil if neither is set.
+func setupTransport() http.RoundTripper {
+	record, replay := viper.GetString("record"), viper.GetString("replay")
+	switch {
+	case record != "" && replay != "":
+		log.Fatalln("--record and --replay are mutually exclusive")
+	case replay != "":
+		log.Infoln("Replaying router responses from", replay)
+		return &collector.Replayer{Dir: replay}
+	case record != "":
+		recordRedactor := redactor
+		if recordRedactor == nil {
+			key := make([]byte, 16)
+			if _, err := rand.Read(key); err != nil {
+				log.Fatalln(err)
+			}
+			var err error
+			recordRedactor, err = collector.ParseRedactor("*=hash", hex.EncodeToString(key))
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		log.Infoln("Recording router responses to", record)
+		return &collector.Recorder{Dir: record, Redactor: recordRedactor}
+	}
+	return nil
+}
+
+// newRouter creates a router client for the configured host and transport,
+// instrumented by clientMetrics.
+func newRouter() *collector.HitronRouter {
+	router := collector.NewHitronRouter(viper.GetString("host"), viper.GetString("user"), viper.GetString("pass"))
+	router.SetTransport(clientMetrics)
+	return router
+}
+
 func startServer() {
 	log.Infoln("Starting hitron-exporter")
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-            <head><title>hitron-exporter</title></head>
-            <body>
-            <h1>hitron-exporter</h1>
-            <a href="/metrics">metrics</a>
-            </body>
-            </html>`))
-	})
-	http.HandleFunc("/metrics", handleMetricsRequest)
+	http.HandleFunc("/", handleStatusPage)
+	if viper.GetBool("prometheus") {
+		http.Handle("/metrics", metricsHandler())
+	}
+	if viper.GetBool("api") {
+		http.HandleFunc("GET /api/v1/status", handleStatusRequest)
+		http.HandleFunc("GET /api/v1/status/{section}", handleSectionRequest)
+	}
+	if historyStore != nil {
+		http.HandleFunc("GET /api/v1/history/{table}", handleHistoryRequest)
+	}
+	if alerts != nil {
+		http.HandleFunc("GET /alerts", handleAlertsPage)
+		http.HandleFunc("GET /api/v1/alerts", handleAlertsRequest)
+		http.HandleFunc("POST /alerts/silences", handleSilenceRequest)
+		http.HandleFunc("POST /alerts/silences/{id}/expire", handleExpireSilenceRequest)
+	}
 
 	bindHost := viper.GetString("bind")
 	log.Infoln("Listening on", bindHost)
 	log.Fatal(http.ListenAndServe(bindHost, nil))
 }
 
-func handleMetricsRequest(w http.ResponseWriter, request *http.Request) {
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(&collector.Collector{
-		Router: collector.NewHitronRouter(viper.GetString("host"), viper.GetString("user"), viper.GetString("pass")),
+func newCollector() *collector.Collector {
+	return &collector.Collector{
+		Router:   newRouter(),
+		OUI:      vendors,
+		Redactor: redactor,
+
+		MaxLanDevices: viper.GetInt("max-lan-devices"),
+		Events:        events,
+		Prefix:        prefix,
+		Status:        status,
+		Extra:         extraEndpoints,
+		Health:        healthProfile,
+
+		ScrapeDuration: scrapeDuration,
+	}
+}
+
+// metricsHandler serves the self metrics together with a fresh scrape of the
+// router, counting its own requests in promhttp_metric_handler_requests_total.
+func metricsHandler() http.Handler {
+	router := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		refreshMutex.Lock()
+		defer refreshMutex.Unlock()
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newCollector())
+		return registry.Gather()
 	})
-	promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+	return promhttp.InstrumentMetricHandler(selfMetrics, promhttp.HandlerFor(prometheus.Gatherers{selfMetrics, router}, promhttp.HandlerOpts{
 		ErrorLog:      log.New(),
 		ErrorHandling: promhttp.ContinueOnError,
-	}).ServeHTTP(w, request)
+	}))
 }
@@ -0,0 +1,123 @@
+package mqtt
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// sensor describes one Home Assistant entity read from a state topic.
+type sensor struct {
+	component   string // sensor or binary_sensor
+	object      string
+	name        string
+	field       string
+	unit        string
+	deviceClass string
+	stateClass  string
+	// onValue is the Jinja literal a binary_sensor field equals when on.
+	onValue string
+}
+
+// sensors maps state topics (without channel ids) to their entities.
+var sensors = map[string][]sensor{
+	"login": {
+		{component: "binary_sensor", object: "login", name: "Login", field: "success",
+			deviceClass: "connectivity", onValue: "true"},
+	},
+	"sysinfo": {
+		{component: "sensor", object: "uptime", name: "Uptime", field: "uptime",
+			unit: "s", deviceClass: "duration", stateClass: "total_increasing"},
+		{component: "sensor", object: "wan_rx_bytes", name: "WAN received", field: "wan_rx_bytes",
+			unit: "B", deviceClass: "data_size", stateClass: "total_increasing"},
+		{component: "sensor", object: "wan_tx_bytes", name: "WAN sent", field: "wan_tx_bytes",
+			unit: "B", deviceClass: "data_size", stateClass: "total_increasing"},
+		{component: "binary_sensor", object: "delegated_prefix", name: "IPv6 prefix", field: "delegated_prefix",
+			deviceClass: "connectivity", onValue: "true"},
+	},
+	"provisioning": {
+		{component: "binary_sensor", object: "registration", name: "DOCSIS registration", field: "registration",
+			deviceClass: "connectivity", onValue: "'" + collector.StatusSuccess + "'"},
+		{component: "binary_sensor", object: "network_access", name: "Network access", field: "network_access",
+			deviceClass: "connectivity", onValue: "'" + collector.NetworkAccessPermitted + "'"},
+	},
+	// Home Assistant's signal_strength only takes dB and dBm, so the dBmV
+	// power sensors go without a device class.
+	"downstream": {
+		{component: "sensor", object: "power", name: "power", field: "power",
+			unit: "dBmV", stateClass: "measurement"},
+		{component: "sensor", object: "snr", name: "SNR", field: "snr",
+			unit: "dB", deviceClass: "signal_strength", stateClass: "measurement"},
+	},
+	"upstream": {
+		{component: "sensor", object: "power", name: "power", field: "power",
+			unit: "dBmV", stateClass: "measurement"},
+	},
+}
+
+// publishDiscovery sends retained discovery configs for state topics which
+// haven't been announced since the last connect.
+func (p *Publisher) publishDiscovery(info *collector.SysInfo, messages []message) {
+	device := map[string]interface{}{
+		"identifiers":  []string{p.opts.NodeId},
+		"name":         "Hitron " + p.opts.NodeId,
+		"manufacturer": "Hitron Technologies",
+	}
+	if info != nil {
+		if info.ModelName != "" {
+			device["model"] = info.ModelName
+		}
+		device["hw_version"] = info.HwVersion
+		device["sw_version"] = info.SwVersion
+	}
+
+	for _, m := range messages {
+		kind, channel, _ := strings.Cut(m.topic, "/")
+		for _, s := range sensors[kind] {
+			object, name := s.object, s.name
+			if channel != "" {
+				object = kind + "_" + channel + "_" + s.object
+				name = kind + " " + channel + " " + s.name
+			}
+			topic := p.opts.DiscoveryPrefix + "/" + s.component + "/" + p.opts.NodeId + "/" + object + "/config"
+
+			p.mutex.Lock()
+			sent := p.discovered[topic]
+			p.mutex.Unlock()
+			if sent {
+				continue
+			}
+
+			config := map[string]interface{}{
+				"name":               name,
+				"unique_id":          p.opts.NodeId + "_" + object,
+				"state_topic":        p.topic(m.topic),
+				"value_template":     "{{ value_json." + s.field + " }}",
+				"availability_topic": p.availabilityTopic(),
+				"device":             device,
+			}
+			if s.unit != "" {
+				config["unit_of_measurement"] = s.unit
+			}
+			if s.deviceClass != "" {
+				config["device_class"] = s.deviceClass
+			}
+			if s.stateClass != "" {
+				config["state_class"] = s.stateClass
+			}
+			if s.onValue != "" {
+				// rendered to Home Assistant's default payloads ON/OFF
+				config["value_template"] = "{{ 'ON' if value_json." + s.field + " == " + s.onValue + " else 'OFF' }}"
+			}
+			if err := p.publishJSON(topic, config, true); err != nil {
+				log.Warn("MQTT discovery: ", err)
+				continue
+			}
+			p.mutex.Lock()
+			p.discovered[topic] = true
+			p.mutex.Unlock()
+		}
+	}
+}
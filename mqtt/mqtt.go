@@ -0,0 +1,228 @@
+// Package mqtt publishes router polls to an MQTT broker, including Home
+// Assistant discovery configs so the sensors show up automatically.
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+type Options struct {
+	Broker   string // tcp://broker:1883 or ssl://broker:8883
+	ClientId string
+	Username string
+	Password string
+
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// TopicPrefix is prepended to all state topics.
+	TopicPrefix string
+	// DiscoveryPrefix is Home Assistant's discovery prefix. Empty disables discovery.
+	DiscoveryPrefix string
+	// NodeId identifies the router in discovery topics and unique ids.
+	NodeId string
+
+	// Redactor is applied to identifying values. May be nil.
+	Redactor *collector.Redactor
+}
+
+// Publisher posts the sections of a Status to MQTT.
+type Publisher struct {
+	opts   Options
+	client paho.Client
+
+	mutex      sync.Mutex
+	discovered map[string]bool // discovery topics already sent
+}
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	qos            = 1
+	publishTimeout = 10 * time.Second
+)
+
+// New connects to the broker. The availability topic is set to "online"
+// on every (re)connect and to "offline" by the broker's last will.
+func New(opts Options) (*Publisher, error) {
+	p := &Publisher{opts: opts, discovered: map[string]bool{}}
+
+	clientOpts := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientId).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(p.availabilityTopic(), payloadOffline, qos, true).
+		SetOnConnectHandler(func(client paho.Client) {
+			log.Infoln("MQTT connected to", opts.Broker)
+			client.Publish(p.availabilityTopic(), qos, true, payloadOnline)
+			p.mutex.Lock()
+			p.discovered = map[string]bool{} // broker may have lost retained configs
+			p.mutex.Unlock()
+		}).
+		SetConnectionLostHandler(func(client paho.Client, err error) {
+			log.Warn("MQTT connection lost: ", err)
+		})
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+
+	p.client = paho.NewClient(clientOpts)
+	token := p.client.Connect()
+	if !token.WaitTimeout(publishTimeout) {
+		log.Warn("MQTT: broker not reachable yet, retrying in the background")
+	} else if err := token.Error(); err != nil {
+		return nil, errors.Wrap(err, "connecting to MQTT broker")
+	}
+	return p, nil
+}
+
+func (o Options) tlsConfig() (*tls.Config, error) {
+	if o.CAFile == "" && o.CertFile == "" && !o.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading MQTT CA file")
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in MQTT CA file")
+		}
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading MQTT client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Close marks the exporter offline and disconnects.
+func (p *Publisher) Close() {
+	p.client.Publish(p.availabilityTopic(), qos, true, payloadOffline).WaitTimeout(publishTimeout)
+	p.client.Disconnect(250)
+}
+
+func (p *Publisher) topic(suffix string) string {
+	return p.opts.TopicPrefix + "/" + suffix
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.topic("availability")
+}
+
+// Publish sends every section fetched at or after since.
+func (p *Publisher) Publish(status *collector.Status, since time.Time) error {
+	var messages []message
+
+	if login, ok := status.Get(collector.SectionLogin); ok {
+		messages = append(messages, message{"login", map[string]interface{}{
+			"success": login.Error == "",
+			"error":   login.Error,
+		}})
+	}
+	info, t, ok := collector.Latest[*collector.SysInfo](status, collector.SectionInfo)
+	if ok && !t.Before(since) {
+		lanRecv, lanSend := info.Traffic("lan")
+		wanRecv, wanSend := info.Traffic("wan")
+		messages = append(messages, message{"sysinfo", map[string]interface{}{
+			"hw_version":       info.HwVersion,
+			"sw_version":       info.SwVersion,
+			"serial":           p.opts.Redactor.Redact(collector.FieldSerial, info.SerialNumber),
+			"uptime":           info.Uptime(),
+			"lan_rx_bytes":     lanRecv,
+			"lan_tx_bytes":     lanSend,
+			"wan_rx_bytes":     wanRecv,
+			"wan_tx_bytes":     wanSend,
+			"delegated_prefix": info.HasDelegatedPrefix(),
+		}})
+	}
+	if cmInit, t, ok := collector.Latest[*collector.CMInit](status, collector.SectionCMInit); ok && !t.Before(since) {
+		messages = append(messages, message{"provisioning", map[string]interface{}{
+			"hw_init":         cmInit.HwInit,
+			"find_downstream": cmInit.FindDownstream,
+			"ranging":         cmInit.Ranging,
+			"dhcp":            cmInit.Dhcp,
+			"download_config": cmInit.DownloadCfg,
+			"registration":    cmInit.Registration,
+			"network_access":  cmInit.NetworkAccess,
+			"bpi_status":      cmInit.BpiStatus,
+		}})
+	}
+	downstream, t, ok := collector.Latest[[]collector.DownstreamInfo](status, collector.SectionDownstream)
+	if ok && !t.Before(since) {
+		for _, ch := range downstream {
+			messages = append(messages, message{"downstream/" + strconv.Itoa(ch.ChannelId), map[string]interface{}{
+				"frequency":  ch.Frequency,
+				"power":      ch.SignalStrength,
+				"snr":        ch.Snr,
+				"modulation": ch.Modulation.String(),
+			}})
+		}
+	}
+	upstream, t, ok := collector.Latest[[]collector.UpstreamInfo](status, collector.SectionUpstream)
+	if ok && !t.Before(since) {
+		for _, ch := range upstream {
+			messages = append(messages, message{"upstream/" + strconv.Itoa(ch.ChannelId), map[string]interface{}{
+				"frequency": ch.Frequency,
+				"bandwidth": ch.Bandwidth,
+				"power":     ch.SignalStrength,
+				"mode":      ch.ScdmaMode,
+			}})
+		}
+	}
+
+	if p.opts.DiscoveryPrefix != "" {
+		p.publishDiscovery(info, messages)
+	}
+	var failed error
+	for _, m := range messages {
+		if err := p.publishJSON(p.topic(m.topic), m.payload, false); err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+type message struct {
+	topic   string
+	payload map[string]interface{}
+}
+
+func (p *Publisher) publishJSON(topic string, payload interface{}, retain bool) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	token := p.client.Publish(topic, qos, retain, data)
+	if !token.WaitTimeout(publishTimeout) {
+		return errors.New("publishing " + topic + ": timeout")
+	}
+	return errors.Wrap(token.Error(), "publishing "+topic)
+}
@@ -0,0 +1,97 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+func TestPublishWithDiscovery(t *testing.T) {
+	broker := mochi.New(&mochi.Options{InlineClient: true})
+	broker.AddHook(new(auth.AllowHook), nil)
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := broker.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	go broker.Serve()
+	defer broker.Close()
+
+	var mutex sync.Mutex
+	received := map[string][]byte{}
+	broker.Subscribe("#", 1, func(cl *mochi.Client, sub packets.Subscription, pk packets.Packet) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received[pk.TopicName] = pk.Payload
+	})
+
+	p, err := New(Options{
+		Broker:          "tcp://" + tcp.Address(),
+		ClientId:        "hitron-test",
+		TopicPrefix:     "hitron",
+		DiscoveryPrefix: "homeassistant",
+		NodeId:          "cgnv4",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := collector.NewStatus()
+	since := time.Now()
+	status.Set(collector.SectionLogin, true, nil)
+	status.Set(collector.SectionDownstream, []collector.DownstreamInfo{
+		{PortId: 1, ChannelId: 7, SignalStrength: 3.5, Snr: 36.4},
+	}, nil)
+	if err := p.Publish(status, since); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mutex.Lock()
+		done := string(received["hitron/availability"]) == payloadOffline
+		mutex.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	var channel map[string]interface{}
+	if err := json.Unmarshal(received["hitron/downstream/7"], &channel); err != nil {
+		t.Fatalf("downstream state: %v (%v)", err, received)
+	}
+	if channel["snr"] != 36.4 {
+		t.Errorf("unexpected snr %v", channel["snr"])
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(received["homeassistant/sensor/cgnv4/downstream_7_snr/config"], &config); err != nil {
+		t.Fatalf("discovery config: %v", err)
+	}
+	if config["state_topic"] != "hitron/downstream/7" || config["availability_topic"] != "hitron/availability" {
+		t.Errorf("unexpected discovery config %v", config)
+	}
+	config = nil
+	if err := json.Unmarshal(received["homeassistant/sensor/cgnv4/downstream_7_power/config"], &config); err != nil {
+		t.Fatalf("discovery config: %v", err)
+	}
+	if _, ok := config["device_class"]; ok || config["unit_of_measurement"] != "dBmV" {
+		t.Errorf("dBmV sensor must not have a device class: %v", config)
+	}
+	if _, ok := received["homeassistant/binary_sensor/cgnv4/login/config"]; !ok {
+		t.Error("missing login discovery config")
+	}
+	if string(received["hitron/availability"]) != payloadOffline {
+		t.Errorf("expected offline after Close, got %q", received["hitron/availability"])
+	}
+}
@@ -0,0 +1,91 @@
+// Package otlp exports the collector's Prometheus metrics to an
+// OpenTelemetry collector over OTLP/HTTP or OTLP/gRPC.
+package otlp
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	bridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+type Options struct {
+	// Protocol is "http" (default) or "grpc".
+	Protocol string
+	// Endpoint is the collector URL, e.g. http://otel-collector:4318.
+	// An https scheme enables TLS. If empty, the OTEL_EXPORTER_OTLP_* environment
+	// variables or the OTLP default for the protocol are used.
+	Endpoint string
+	Headers  map[string]string
+	Interval time.Duration
+	// Attributes are added to the resource, e.g. hitron.router.serial or site.
+	Attributes map[string]string
+}
+
+// Start periodically gathers metrics from gatherer and exports them until
+// the returned shutdown function is called. Prometheus gauges and counters
+// become OTel gauges and cumulative sums, histograms stay histograms.
+func Start(ctx context.Context, gatherer prometheus.Gatherer, opts Options) (func(context.Context) error, error) {
+	exporter, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", "hitron-exporter")}
+	keys := make([]string, 0, len(opts.Attributes))
+	for k := range opts.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, attribute.String(k, opts.Attributes[k]))
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(opts.Interval),
+		sdkmetric.WithProducer(bridge.NewMetricProducer(bridge.WithGatherer(gatherer))))
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(attrs...)))
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, opts Options) (sdkmetric.Exporter, error) {
+	switch opts.Protocol {
+	case "", "http":
+		var options []otlpmetrichttp.Option
+		if opts.Endpoint != "" {
+			u, err := url.Parse(opts.Endpoint)
+			if err != nil {
+				return nil, errors.Wrap(err, "parsing OTLP endpoint")
+			}
+			if u.Path == "" || u.Path == "/" {
+				u.Path = "/v1/metrics"
+			}
+			options = append(options, otlpmetrichttp.WithEndpointURL(u.String()))
+		}
+		if len(opts.Headers) > 0 {
+			options = append(options, otlpmetrichttp.WithHeaders(opts.Headers))
+		}
+		return otlpmetrichttp.New(ctx, options...)
+	case "grpc":
+		var options []otlpmetricgrpc.Option
+		if opts.Endpoint != "" {
+			options = append(options, otlpmetricgrpc.WithEndpointURL(opts.Endpoint))
+		}
+		if len(opts.Headers) > 0 {
+			options = append(options, otlpmetricgrpc.WithHeaders(opts.Headers))
+		}
+		return otlpmetricgrpc.New(ctx, options...)
+	}
+	return nil, errors.New("unknown OTLP protocol '" + opts.Protocol + "'")
+}
@@ -0,0 +1,65 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExportOverHTTP(t *testing.T) {
+	requests := make(chan *colmetrics.ExportMetricsServiceRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req colmetrics.ExportMetricsServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Error(err)
+		}
+		requests <- &req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		data, _ := proto.Marshal(&colmetrics.ExportMetricsServiceResponse{})
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "hitron_login_success_bool", Help: "test"})
+	gauge.Set(1)
+	registry.MustRegister(gauge)
+
+	shutdown, err := Start(context.Background(), registry, Options{
+		Endpoint:   server.URL,
+		Interval:   time.Hour,
+		Attributes: map[string]string{"site": "office"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// shutdown flushes the pending collection
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	rm := req.ResourceMetrics[0]
+	attrs := map[string]string{}
+	for _, kv := range rm.Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	if attrs["site"] != "office" || attrs["service.name"] != "hitron-exporter" {
+		t.Errorf("unexpected resource attributes %v", attrs)
+	}
+	metric := rm.ScopeMetrics[0].Metrics[0]
+	if metric.Name != "hitron_login_success_bool" || metric.GetGauge().DataPoints[0].GetAsDouble() != 1 {
+		t.Errorf("unexpected metric %v", metric)
+	}
+}
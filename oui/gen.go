@@ -0,0 +1,60 @@
+//go:build ignore
+
+// gen downloads the IEEE MA-L, MA-M and MA-S registries and writes them,
+// without the address column, to oui.csv.
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var registries = []string{
+	"https://standards-oui.ieee.org/oui/oui.csv",
+	"https://standards-oui.ieee.org/oui28/mam.csv",
+	"https://standards-oui.ieee.org/oui36/oui36.csv",
+}
+
+func main() {
+	out, err := os.Create("oui.csv")
+	if err != nil {
+		log.Fatalln("creating oui.csv:", err)
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	w.Write([]string{"Registry", "Assignment", "Organization Name"})
+
+	for _, url := range registries {
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatalln("downloading", url, err)
+		}
+		r := csv.NewReader(resp.Body)
+		r.FieldsPerRecord = -1
+		if _, err := r.Read(); err != nil { // header
+			log.Fatalln("reading", url, err)
+		}
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatalln("reading", url, err)
+			}
+			if len(record) < 3 {
+				continue
+			}
+			w.Write(record[:3])
+		}
+		resp.Body.Close()
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalln("writing oui.csv:", err)
+	}
+}
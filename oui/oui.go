@@ -0,0 +1,130 @@
+// Package oui maps MAC addresses to the vendor that registered their
+// Organizationally Unique Identifier with the IEEE.
+package oui
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate go run gen.go
+
+// embedded is a trimmed copy of the IEEE registry in oui.csv format.
+// Run `go generate ./oui` to refresh it from standards-oui.ieee.org.
+//
+//go:embed oui.csv
+var embedded string
+
+// Default is the database built from the embedded registry.
+var Default = mustParse(embedded)
+
+// DB holds vendor names keyed by upper-case hex prefix.
+// MA-L (6 digit), MA-M (7 digit) and MA-S (9 digit) assignments are supported.
+type DB struct {
+	vendors map[string]string
+}
+
+// Parse reads a registry in the IEEE oui.csv format
+// ("Registry,Assignment,Organization Name,Organization Address").
+// Only the Assignment and Organization Name columns are used.
+func Parse(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading header")
+	}
+	assignmentCol, nameCol := -1, -1
+	for i, col := range header {
+		switch strings.TrimSpace(col) {
+		case "Assignment":
+			assignmentCol = i
+		case "Organization Name":
+			nameCol = i
+		}
+	}
+	if assignmentCol < 0 || nameCol < 0 {
+		return nil, errors.New("missing Assignment or Organization Name column")
+	}
+
+	db := &DB{vendors: map[string]string{}}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading record")
+		}
+		if len(record) <= assignmentCol || len(record) <= nameCol {
+			continue
+		}
+		prefix := normalize(record[assignmentCol])
+		if len(prefix) < 6 {
+			continue
+		}
+		db.vendors[prefix] = strings.TrimSpace(record[nameCol])
+	}
+	return db, nil
+}
+
+// LoadFile parses the registry stored at path.
+func LoadFile(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+func mustParse(raw string) *DB {
+	db, err := Parse(strings.NewReader(raw))
+	if err != nil {
+		panic("parsing embedded oui.csv: " + err.Error())
+	}
+	return db
+}
+
+// Lookup returns the vendor registered for mac, or "" if it is unknown.
+// The longest matching assignment wins.
+func (db *DB) Lookup(mac string) string {
+	if db == nil {
+		return ""
+	}
+	hex := normalize(mac)
+	for _, n := range []int{9, 7, 6} {
+		if len(hex) < n {
+			continue
+		}
+		if vendor, ok := db.vendors[hex[:n]]; ok {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// Len returns the number of assignments in the database.
+func (db *DB) Len() int {
+	if db == nil {
+		return 0
+	}
+	return len(db.vendors)
+}
+
+// normalize strips separators and upper-cases a MAC address or prefix.
+func normalize(mac string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(mac) {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'F') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
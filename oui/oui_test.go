@@ -0,0 +1,11 @@
+package oui
+
+import "fmt"
+
+func ExampleDB_Lookup() {
+	fmt.Println(Default.Lookup("b8:27:eb:12:34:56"))
+	fmt.Printf("%q\n", Default.Lookup("02:00:00:00:00:01"))
+	// Output:
+	// Raspberry Pi Foundation
+	// ""
+}
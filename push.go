@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/cfstras/hitron-exporter/collector"
+	"github.com/cfstras/hitron-exporter/history"
+	"github.com/cfstras/hitron-exporter/influx"
+	"github.com/cfstras/hitron-exporter/mqtt"
+	"github.com/cfstras/hitron-exporter/otlp"
+	"github.com/cfstras/hitron-exporter/remotewrite"
+)
+
+// pushOutputs are called after every poll in push mode with the time the
+// poll started and the gathered metrics. Sections fetched since then are fresh.
+var pushOutputs []func(since time.Time, families []*dto.MetricFamily)
+
+// setupPushOutputs registers the push outputs enabled by flags.
+func setupPushOutputs() {
+	if rawUrl := viper.GetString("influx-url"); rawUrl != "" {
+		writer := influx.NewWriter(rawUrl, viper.GetString("influx-org"),
+			viper.GetString("influx-bucket"), viper.GetString("influx-token"))
+		writer.BatchSize = viper.GetInt("influx-batch-size")
+		writer.BufferDir = viper.GetString("influx-buffer-dir")
+		writer.MaxBufferBytes = viper.GetInt64("influx-buffer-max-bytes")
+		encoder := &influx.Encoder{
+			Tags:     parseKeyValues(viper.GetString("influx-tags")),
+			Redactor: redactor,
+		}
+		pushOutputs = append(pushOutputs, func(since time.Time, _ []*dto.MetricFamily) {
+			if err := writer.Write(encoder.Encode(status, since)); err != nil {
+				log.Warn("InfluxDB: ", err)
+			}
+		})
+		log.Infoln("Pushing to InfluxDB at", rawUrl)
+	}
+	if broker := viper.GetString("mqtt-broker"); broker != "" {
+		publisher, err := mqtt.New(mqtt.Options{
+			Broker:             broker,
+			ClientId:           viper.GetString("mqtt-client-id"),
+			Username:           viper.GetString("mqtt-user"),
+			Password:           viper.GetString("mqtt-pass"),
+			CAFile:             viper.GetString("mqtt-ca-file"),
+			CertFile:           viper.GetString("mqtt-cert-file"),
+			KeyFile:            viper.GetString("mqtt-key-file"),
+			InsecureSkipVerify: viper.GetBool("mqtt-insecure"),
+			TopicPrefix:        viper.GetString("mqtt-topic-prefix"),
+			DiscoveryPrefix:    viper.GetString("mqtt-discovery-prefix"),
+			NodeId:             viper.GetString("mqtt-node-id"),
+			Redactor:           redactor,
+		})
+		if err != nil {
+			log.Fatalln("MQTT:", err)
+		}
+		pushOutputs = append(pushOutputs, func(since time.Time, _ []*dto.MetricFamily) {
+			if err := publisher.Publish(status, since); err != nil {
+				log.Warn("MQTT: ", err)
+			}
+		})
+		log.Infoln("Publishing to MQTT broker", broker)
+	}
+	if rawUrl := viper.GetString("remote-write-url"); rawUrl != "" {
+		client := remotewrite.NewClient(rawUrl)
+		client.BearerToken = viper.GetString("remote-write-bearer-token")
+		client.Username = viper.GetString("remote-write-user")
+		client.Password = viper.GetString("remote-write-pass")
+		client.Labels = parseKeyValues(viper.GetString("remote-write-labels"))
+		client.WALDir = viper.GetString("remote-write-wal-dir")
+		client.MaxWALBytes = viper.GetInt64("remote-write-wal-max-bytes")
+		pushOutputs = append(pushOutputs, func(since time.Time, families []*dto.MetricFamily) {
+			if err := client.Write(families, since); err != nil {
+				log.Warn("Remote write: ", err)
+			}
+		})
+		log.Infoln("Remote writing to", rawUrl)
+	}
+	if path := viper.GetString("history-db"); path != "" {
+		store, err := history.Open(path)
+		if err != nil {
+			log.Fatalln("History:", err)
+		}
+		store.RawRetention = viper.GetDuration("history-raw-retention")
+		store.DownsampleStep = viper.GetDuration("history-downsample-step")
+		store.Retention = viper.GetDuration("history-retention")
+		historyStore = store
+		pushOutputs = append(pushOutputs, func(since time.Time, _ []*dto.MetricFamily) {
+			if err := store.Record(status, since); err != nil {
+				log.Warn("History: ", err)
+			}
+		})
+		log.Infoln("Recording history to", path)
+	}
+}
+
+// startPushLoop polls the router every --push-interval and hands the
+// result to all push outputs.
+func startPushLoop() {
+	if len(pushOutputs) == 0 {
+		return
+	}
+	interval := viper.GetDuration("push-interval")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			since, families := pollRouter()
+			for _, output := range pushOutputs {
+				output(since, families)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// startOTLP exports the collector's metrics over OTLP if --otlp-endpoint is set.
+// The OTel SDK runs its own timer, so this is independent of the push loop.
+// The resource is fixed for the exporter's lifetime, so the export starts in
+// the background once a poll has returned the router's identity.
+func startOTLP() {
+	endpoint := viper.GetString("otlp-endpoint")
+	if endpoint == "" {
+		return
+	}
+	interval := viper.GetDuration("push-interval")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			// shares a recent poll, e.g. the push loop's, instead of polling again
+			refreshStatus()
+			if _, _, ok := collector.Latest[*collector.SysInfo](status, collector.SectionInfo); ok {
+				break
+			}
+			log.Warn("OTLP: router info not available, retrying in ", interval)
+			<-ticker.C
+		}
+		exportOTLP(endpoint, interval)
+	}()
+}
+
+func exportOTLP(endpoint string, interval time.Duration) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newCollector(), clientMetrics)
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		refreshMutex.Lock()
+		defer refreshMutex.Unlock()
+		return registry.Gather()
+	})
+
+	info, _, _ := collector.Latest[*collector.SysInfo](status, collector.SectionInfo)
+	attributes := map[string]string{
+		"hitron.router.serial":     redactor.Redact(collector.FieldSerial, info.SerialNumber),
+		"hitron.router.hw_version": info.HwVersion,
+		"hitron.router.sw_version": info.SwVersion,
+	}
+	if info.ModelName != "" {
+		attributes["hitron.router.model"] = info.ModelName
+	}
+	for k, v := range parseKeyValues(viper.GetString("otlp-attributes")) {
+		attributes[k] = v
+	}
+
+	_, err := otlp.Start(context.Background(), gatherer, otlp.Options{
+		Protocol:   viper.GetString("otlp-protocol"),
+		Endpoint:   endpoint,
+		Headers:    parseKeyValues(viper.GetString("otlp-headers")),
+		Interval:   interval,
+		Attributes: attributes,
+	})
+	if err != nil {
+		log.Fatalln("OTLP:", err)
+	}
+	log.Infoln("Exporting OTLP metrics to", endpoint)
+}
+
+// pollRouter gathers all metrics, which also refreshes status, and returns
+// the time the poll started.
+func pollRouter() (time.Time, []*dto.MetricFamily) {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+	since := time.Now()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newCollector(), clientMetrics)
+	families, err := registry.Gather()
+	if err != nil {
+		log.Info("Gathering metrics: ", err)
+	}
+	return since, families
+}
+
+// parseKeyValues parses "key=value,key=value".
+func parseKeyValues(raw string) map[string]string {
+	values := map[string]string{}
+	for _, kv := range strings.Split(raw, ",") {
+		split := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(split) == 2 && split[0] != "" {
+			values[split[0]] = split[1]
+		}
+	}
+	return values
+}
@@ -0,0 +1,210 @@
+package remotewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Client sends samples to a remote_write endpoint.
+//
+// Every request is first appended to a write-ahead buffer: files in WALDir,
+// or memory if WALDir is empty. Buffered requests are sent oldest first and
+// removed once the endpoint accepted them, so samples gathered during an
+// outage are delivered when it's over.
+type Client struct {
+	URL         string
+	BearerToken string
+	Username    string
+	Password    string
+	// Labels are added to every series, e.g. instance or site.
+	Labels map[string]string
+
+	MaxRetries   int
+	RetryBackoff time.Duration
+	WALDir       string
+	// MaxWALBytes limits the buffer; the oldest requests are dropped first.
+	// Zero means no limit.
+	MaxWALBytes int64
+
+	Client *http.Client
+
+	mutex  sync.Mutex
+	memory [][]byte // used if WALDir is empty
+}
+
+// errPermanent marks responses which will not succeed on retry.
+var errPermanent = errors.New("rejected by server")
+
+// NewClient returns a Client with default retry settings.
+func NewClient(rawUrl string) *Client {
+	return &Client{
+		URL:          rawUrl,
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+		Client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Write buffers the samples of families, taken at t, and sends everything
+// buffered so far.
+func (c *Client) Write(families []*dto.MetricFamily, t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data := snappy.Encode(nil, Encode(families, t, c.Labels))
+	if err := c.append(data); err != nil {
+		log.Warn("Remote write buffer: ", err)
+	}
+	return c.flush()
+}
+
+func (c *Client) append(data []byte) error {
+	if c.WALDir == "" {
+		c.memory = append(c.memory, data)
+		c.trimMemory()
+		return nil
+	}
+	if err := os.MkdirAll(c.WALDir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(c.WALDir, fmt.Sprintf("%020d.snappy", time.Now().UnixNano()))
+	if err := os.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	c.trimWAL()
+	return nil
+}
+
+// flush sends buffered requests oldest first until one fails.
+func (c *Client) flush() error {
+	if c.WALDir == "" {
+		for len(c.memory) > 0 {
+			err := c.sendWithRetry(c.memory[0])
+			if err != nil && !errors.Is(err, errPermanent) {
+				return err
+			} else if err != nil {
+				log.Warn("Dropping remote write request: ", err)
+			}
+			c.memory = c.memory[1:]
+		}
+		return nil
+	}
+	for _, f := range c.walFiles() {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			log.Warn("Reading remote write WAL: ", err)
+			continue
+		}
+		err = c.sendWithRetry(data)
+		if err != nil && !errors.Is(err, errPermanent) {
+			return err
+		} else if err != nil {
+			log.Warn("Dropping remote write request: ", err)
+		}
+		os.Remove(f)
+	}
+	return nil
+}
+
+func (c *Client) sendWithRetry(data []byte) error {
+	var err error
+	backoff := c.RetryBackoff
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = c.send(data)
+		if err == nil || errors.Is(err, errPermanent) {
+			return err
+		}
+		log.Debugf("Remote write attempt %d failed: %v", attempt+1, err)
+	}
+	return err
+}
+
+func (c *Client) send(data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(errPermanent, err.Error())
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "hitron-exporter")
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return errors.Wrap(errPermanent, fmt.Sprintf("%s: %s", resp.Status, body))
+}
+
+func (c *Client) walFiles() []string {
+	files, _ := filepath.Glob(filepath.Join(c.WALDir, "*.snappy"))
+	sort.Strings(files)
+	return files
+}
+
+// trimWAL removes the oldest requests until WALDir fits MaxWALBytes.
+func (c *Client) trimWAL() {
+	if c.MaxWALBytes <= 0 {
+		return
+	}
+	files := c.walFiles()
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		if stat, err := os.Stat(f); err == nil {
+			sizes[i] = stat.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(files) && total > c.MaxWALBytes; i++ {
+		log.Warn("Remote write WAL full, dropping ", files[i])
+		os.Remove(files[i])
+		total -= sizes[i]
+	}
+}
+
+func (c *Client) trimMemory() {
+	if c.MaxWALBytes <= 0 {
+		return
+	}
+	var total int64
+	for _, data := range c.memory {
+		total += int64(len(data))
+	}
+	for len(c.memory) > 0 && total > c.MaxWALBytes {
+		log.Warn("Remote write buffer full, dropping oldest request")
+		total -= int64(len(c.memory[0]))
+		c.memory = c.memory[1:]
+	}
+}
@@ -0,0 +1,136 @@
+// Package remotewrite pushes gathered metrics to a Prometheus remote_write
+// endpoint, for routers behind NAT which can't be scraped.
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// series is one sample of a time series, before encoding.
+type series struct {
+	labels []label
+	value  float64
+}
+
+type label struct {
+	name, value string
+}
+
+// Encode converts metric families into a remote_write WriteRequest protobuf
+// (not yet compressed). Every sample gets timestamp t unless the metric has
+// its own. extraLabels are added to every series, without overriding labels
+// the metric already has. Labels with empty values are left out, as
+// Prometheus treats them as absent.
+func Encode(families []*dto.MetricFamily, t time.Time, extraLabels map[string]string) []byte {
+	var buf []byte
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			ts := t.UnixMilli()
+			if metric.TimestampMs != nil {
+				ts = metric.GetTimestampMs()
+			}
+			for _, s := range flatten(family.GetName(), family.GetType(), metric) {
+				s.labels = withExtraLabels(s.labels, extraLabels)
+				buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+				buf = protowire.AppendBytes(buf, encodeSeries(s, ts))
+			}
+		}
+	}
+	return buf
+}
+
+// flatten expands a metric into the series Prometheus would store for it.
+func flatten(name string, kind dto.MetricType, metric *dto.Metric) []series {
+	base := []label{}
+	for _, l := range metric.GetLabel() {
+		if l.GetValue() != "" {
+			base = append(base, label{l.GetName(), l.GetValue()})
+		}
+	}
+	with := func(suffix string, value float64, extra ...label) series {
+		labels := append([]label{{"__name__", name + suffix}}, base...)
+		return series{append(labels, extra...), value}
+	}
+
+	switch kind {
+	case dto.MetricType_COUNTER:
+		return []series{with("", metric.GetCounter().GetValue())}
+	case dto.MetricType_GAUGE:
+		return []series{with("", metric.GetGauge().GetValue())}
+	case dto.MetricType_UNTYPED:
+		return []series{with("", metric.GetUntyped().GetValue())}
+	case dto.MetricType_SUMMARY:
+		summary := metric.GetSummary()
+		var out []series
+		for _, q := range summary.GetQuantile() {
+			out = append(out, with("", q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())}))
+		}
+		return append(out,
+			with("_sum", summary.GetSampleSum()),
+			with("_count", float64(summary.GetSampleCount())))
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		histogram := metric.GetHistogram()
+		var out []series
+		for _, b := range histogram.GetBucket() {
+			out = append(out, with("_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())}))
+		}
+		return append(out,
+			with("_bucket", float64(histogram.GetSampleCount()), label{"le", "+Inf"}),
+			with("_sum", histogram.GetSampleSum()),
+			with("_count", float64(histogram.GetSampleCount())))
+	}
+	return nil
+}
+
+func withExtraLabels(labels []label, extra map[string]string) []label {
+	have := map[string]bool{}
+	for _, l := range labels {
+		have[l.name] = true
+	}
+	for name, value := range extra {
+		if !have[name] && value != "" {
+			labels = append(labels, label{name, value})
+		}
+	}
+	// remote_write requires labels sorted by name
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeSeries encodes a prometheus.TimeSeries message:
+//
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeSeries(s series, timestampMs int64) []byte {
+	var buf []byte
+	for _, l := range s.labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, lb)
+	}
+	var sb []byte
+	sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+	sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(timestampMs))
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	return protowire.AppendBytes(buf, sb)
+}
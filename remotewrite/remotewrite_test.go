@@ -0,0 +1,121 @@
+package remotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decode parses a WriteRequest into "name{labels} value" strings.
+func decode(data []byte) []string {
+	var out []string
+	for len(data) > 0 {
+		_, _, n := protowire.ConsumeTag(data)
+		ts, m := protowire.ConsumeBytes(data[n:])
+		data = data[n+m:]
+
+		var labels []string
+		var value float64
+		for len(ts) > 0 {
+			num, _, n := protowire.ConsumeTag(ts)
+			msg, m := protowire.ConsumeBytes(ts[n:])
+			ts = ts[n+m:]
+			if num == 1 {
+				_, _, n := protowire.ConsumeTag(msg)
+				name, m := protowire.ConsumeString(msg[n:])
+				_, _, n2 := protowire.ConsumeTag(msg[n+m:])
+				val, _ := protowire.ConsumeString(msg[n+m+n2:])
+				labels = append(labels, name+"="+val)
+			} else {
+				_, _, n := protowire.ConsumeTag(msg)
+				bits, _ := protowire.ConsumeFixed64(msg[n:])
+				value = math.Float64frombits(bits)
+			}
+		}
+		out = append(out, strings.Join(labels, ",")+" "+formatFloat(value))
+	}
+	return out
+}
+
+func TestClientBuffersDuringOutage(t *testing.T) {
+	var mutex sync.Mutex
+	down := true
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+		}
+		received = append(received, decode(data)...)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hitron_traffic", Help: "test"}, []string{"if"})
+	registry.MustRegister(gauge)
+
+	c := NewClient(server.URL)
+	c.BearerToken = "secret"
+	c.Labels = map[string]string{"site": "office"}
+	c.MaxRetries = 0
+	c.WALDir = t.TempDir()
+
+	gauge.WithLabelValues("wan").Set(1)
+	families, _ := registry.Gather()
+	if err := c.Write(families, time.Now()); err == nil {
+		t.Fatal("expected error while server is down")
+	}
+
+	mutex.Lock()
+	down = false
+	mutex.Unlock()
+	gauge.WithLabelValues("wan").Set(2)
+	families, _ = registry.Gather()
+	if err := c.Write(families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"__name__=hitron_traffic,if=wan,site=office 1",
+		"__name__=hitron_traffic,if=wan,site=office 2",
+	}
+	if strings.Join(received, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v, want %v", received, want)
+	}
+	if files := c.walFiles(); len(files) != 0 {
+		t.Errorf("expected empty WAL, got %d files", len(files))
+	}
+}
+
+func TestEncodeSkipsEmptyLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hitron_lan_device", Help: "test"}, []string{"hostname", "site"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("", "").Set(1)
+	families, _ := registry.Gather()
+
+	got := decode(Encode(families, time.Now(), map[string]string{"site": "office", "empty": ""}))
+	want := "__name__=hitron_lan_device,site=office 1"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+//go:embed templates/status.html
+var statusTemplateText string
+
+var statusTemplate = template.Must(template.New("status").Parse(statusTemplateText))
+
+type statusPage struct {
+	Updated      time.Time
+	API          bool
+	Prometheus   bool
+	Alerts       bool
+	Login        string
+	Info         *collector.SysInfo
+	Provisioning []provisioningRow
+	Downstream   []channelRow
+	Upstream     []channelRow
+	Devices      []deviceRow
+	Errors       []errorRow
+}
+
+type provisioningRow struct {
+	Name, Value, Class string
+}
+
+type channelRow struct {
+	Port, Channel        int
+	FrequencyMHz         float64
+	Modulation           string
+	Power, Snr           float64
+	PowerClass, SnrClass string
+}
+
+type deviceRow struct {
+	collector.ConnectInfo
+	Online bool
+	Vendor string
+}
+
+type errorRow struct {
+	Time    time.Time
+	Source  string
+	Message string
+}
+
+// maxErrorRows limits the errors shown on the status page.
+const maxErrorRows = 20
+
+func handleStatusPage(w http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" {
+		http.NotFound(w, request)
+		return
+	}
+	refreshStatus()
+
+	page := statusPage{
+		Updated:    status.Updated(),
+		API:        viper.GetBool("api"),
+		Prometheus: viper.GetBool("prometheus"),
+		Alerts:     alerts != nil,
+		Login:      "critical",
+	}
+	if login, ok := status.Get(collector.SectionLogin); ok && login.Error == "" {
+		page.Login = "ok"
+	}
+	if info, _, ok := collector.Latest[*collector.SysInfo](status, collector.SectionInfo); ok {
+		redacted := *info
+		redacted.SerialNumber = redactor.Redact(collector.FieldSerial, info.SerialNumber)
+		redacted.WanIp = redactor.Redact(collector.FieldWanIp, info.WanIp)
+		redacted.DelegatedPrefix = redactor.Redact(collector.FieldIpv6Prefix, info.DelegatedPrefix)
+		page.Info = &redacted
+	}
+
+	if cmInit, _, ok := collector.Latest[*collector.CMInit](status, collector.SectionCMInit); ok {
+		page.Provisioning = []provisioningRow{
+			stepRow("HW Init", cmInit.HwInit, collector.StatusSuccess),
+			stepRow("Find Downstream", cmInit.FindDownstream, collector.StatusSuccess),
+			stepRow("Ranging", cmInit.Ranging, collector.StatusSuccess),
+			stepRow("DHCP", cmInit.Dhcp, collector.StatusSuccess),
+			stepRow("Download CM Config", cmInit.DownloadCfg, collector.StatusSuccess),
+			stepRow("Registration", cmInit.Registration, collector.StatusSuccess),
+			stepRow("Network Access", cmInit.NetworkAccess, collector.NetworkAccessPermitted),
+			{Name: "BPI", Value: cmInit.BpiStatus},
+		}
+	}
+
+	downstream, _, _ := collector.Latest[[]collector.DownstreamInfo](status, collector.SectionDownstream)
+	for _, ch := range downstream {
+		page.Downstream = append(page.Downstream, channelRow{
+			Port: ch.PortId, Channel: ch.ChannelId,
+			FrequencyMHz: float64(ch.Frequency) / 1e6,
+			Modulation:   ch.Modulation.String(),
+			Power:        ch.SignalStrength, PowerClass: healthProfile.DownstreamPower.Classify(ch.SignalStrength).String(),
+			Snr: ch.Snr, SnrClass: healthProfile.DownstreamSnr.Classify(ch.Snr).String(),
+		})
+	}
+	upstream, _, _ := collector.Latest[[]collector.UpstreamInfo](status, collector.SectionUpstream)
+	for _, ch := range upstream {
+		page.Upstream = append(page.Upstream, channelRow{
+			Port: ch.PortId, Channel: ch.ChannelId,
+			FrequencyMHz: float64(ch.Frequency) / 1e6,
+			Modulation:   ch.ScdmaMode,
+			Power:        ch.SignalStrength, PowerClass: healthProfile.UpstreamPower.Classify(ch.SignalStrength).String(),
+		})
+	}
+
+	devices, _, _ := collector.Latest[[]collector.ConnectInfo](status, collector.SectionConnectInfo)
+	for _, device := range devices {
+		row := deviceRow{
+			ConnectInfo: device,
+			Online:      device.Online == "active",
+			Vendor:      vendors.Lookup(device.MacAddr),
+		}
+		row.HostName = redactor.Redact(collector.FieldHostname, device.HostName)
+		row.IpAddr = redactor.Redact(collector.FieldDeviceIp, device.IpAddr)
+		row.MacAddr = redactor.Redact(collector.FieldDeviceMac, device.MacAddr)
+		page.Devices = append(page.Devices, row)
+	}
+	sort.SliceStable(page.Devices, func(i, j int) bool {
+		return page.Devices[i].Online && !page.Devices[j].Online
+	})
+
+	for name, section := range status.Sections() {
+		if section.Error != "" {
+			page.Errors = append(page.Errors, errorRow{section.ErrorTime, name, section.Error})
+		}
+	}
+	entries, _, _ := collector.Latest[[]collector.EventLogEntry](status, collector.SectionDocsisEventLog)
+	for _, entry := range entries {
+		switch strings.ToLower(entry.Priority) {
+		case "emergency", "alert", "critical", "error":
+			t, err := time.ParseInLocation("01/02/2006 15:04:05", entry.Time, time.Local)
+			if err != nil {
+				log.Debug("Parsing event log time: ", err)
+			}
+			page.Errors = append(page.Errors, errorRow{t, "docsis " + entry.Type, redactor.RedactEvent(entry.Event)})
+		}
+	}
+	sort.Slice(page.Errors, func(i, j int) bool { return page.Errors[i].Time.After(page.Errors[j].Time) })
+	if len(page.Errors) > maxErrorRows {
+		page.Errors = page.Errors[:maxErrorRows]
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, page); err != nil {
+		log.Warn("Rendering status page: ", err)
+	}
+}
+
+func stepRow(name, value, expected string) provisioningRow {
+	class := "critical"
+	if value == expected {
+		class = "ok"
+	}
+	return provisioningRow{Name: name, Value: value, Class: class}
+}
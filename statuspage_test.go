@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cfstras/hitron-exporter/collector"
+)
+
+// replay points newRouter at the recorded responses in testdata/capture and
+// resets the state kept between polls.
+func replay() {
+	clientMetrics = collector.NewClientMetrics(&collector.Replayer{Dir: "testdata/capture"})
+	status = collector.NewStatus()
+	events = collector.NewEventLog(nil, nil)
+	redactor = nil
+}
+
+// replayRouter replays like replay, with the identifying values redacted as
+// configured by redact.
+func replayRouter(t *testing.T, redact string) {
+	t.Helper()
+	replay()
+	if redact != "" {
+		var err error
+		if redactor, err = collector.ParseRedactor(redact, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { redactor = nil })
+}
+
+func TestStatusPage(t *testing.T) {
+	replayRouter(t, "")
+	w := httptest.NewRecorder()
+	handleStatusPage(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	if w.Code != 200 {
+		t.Fatalf("got status %d", w.Code)
+	}
+	for _, want := range []string{
+		`<td class="ok">success</td>`,
+		`<td>1A / 4.5.10.201-CD-UPC</td>`,
+		`<th>Registration</th><td class="ok">Success</td>`,
+		// channel 2 is below the SNR and power thresholds
+		`<td class="num warn">-8.1</td><td class="num critical">28.6</td>`,
+		`<td class="num ok">47.5</td>`,
+		`<td>nas</td><td>192.168.0.20</td><td>00:11:32:AB:CD:EF</td><td>Synology Incorporated</td>`,
+		`No Ranging Response received - T3 time-out;CM-MAC=68:8f:12:34:12:34`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page lacks %s", want)
+		}
+	}
+	// online devices come first
+	if strings.Index(body, "00:11:32:AB:CD:EF") > strings.Index(body, "DA:12:34:56:78:9A") {
+		t.Error("offline device listed before the online one")
+	}
+
+	w = httptest.NewRecorder()
+	handleStatusPage(w, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if w.Code != 404 {
+		t.Errorf("got status %d for an unknown path", w.Code)
+	}
+}
+
+func TestStatusPageRedacts(t *testing.T) {
+	replayRouter(t, "*=drop")
+	w := httptest.NewRecorder()
+	handleStatusPage(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	for _, leaked := range []string{"VCAP12345678", "84.12.34.56", "2a02:8070:1234::/56", "nas",
+		"192.168.0.20", "00:11:32:AB:CD:EF", "68:8f:12:34:12:34"} {
+		if strings.Contains(body, leaked) {
+			t.Errorf("status page shows %s", leaked)
+		}
+	}
+	if !strings.Contains(body, "Synology Incorporated") {
+		t.Error("vendor should be resolved before redacting the MAC")
+	}
+}